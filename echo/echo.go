@@ -1,15 +1,43 @@
 package main
 
-import "flag"
+import "bytes"
 import "fmt"
+import "io"
+import "log"
 import "os"
+import "strings"
 
 // suppressNewline specifies whether the trailing newline should be suppressed.
 var suppressNewline bool
 
-func init() {
-	flag.BoolVar(&suppressNewline, "n", false, "Suppress the trailing newline.")
-	flag.Usage = usage
+// interpretEscapes specifies whether backslash escapes should be interpreted.
+var interpretEscapes bool
+
+// parseFlags sets the flags of the leading arguments of args, and returns the
+// remaining arguments. As in other implementations of echo, only arguments
+// consisting of '-' followed by one or more of the flag letters 'n', 'e' and
+// 'E' are flags, which may be combined as in "-ne"; any other argument, such
+// as "-", "--" or "-x", ends the flags and is echoed. Of "-e" and "-E", the
+// last flag takes precedence.
+func parseFlags(args []string) []string {
+	for len(args) > 0 {
+		arg := args[0]
+		if len(arg) < 2 || arg[0] != '-' || strings.Trim(arg[1:], "neE") != "" {
+			break
+		}
+		for _, c := range arg[1:] {
+			switch c {
+			case 'n':
+				suppressNewline = true
+			case 'e':
+				interpretEscapes = true
+			case 'E':
+				interpretEscapes = false
+			}
+		}
+		args = args[1:]
+	}
+	return args
 }
 
 func usage() {
@@ -17,26 +45,149 @@ func usage() {
 	fmt.Fprintln(os.Stderr, "Echo STRING(s) to standard output.")
 	fmt.Fprintln(os.Stderr)
 	fmt.Fprintln(os.Stderr, "Flags:")
-	flag.PrintDefaults()
+	fmt.Fprintln(os.Stderr, "  -n      suppress the trailing newline")
+	fmt.Fprintln(os.Stderr, "  -e      enable interpretation of backslash escapes")
+	fmt.Fprintln(os.Stderr, "  -E      disable interpretation of backslash escapes (default)")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "If -e is in effect, the following sequences are recognized:")
+	fmt.Fprintln(os.Stderr, `  \\      backslash`)
+	fmt.Fprintln(os.Stderr, `  \a      alert (BEL)`)
+	fmt.Fprintln(os.Stderr, `  \b      backspace`)
+	fmt.Fprintln(os.Stderr, `  \c      produce no further output`)
+	fmt.Fprintln(os.Stderr, `  \e      escape`)
+	fmt.Fprintln(os.Stderr, `  \f      form feed`)
+	fmt.Fprintln(os.Stderr, `  \n      new line`)
+	fmt.Fprintln(os.Stderr, `  \r      carriage return`)
+	fmt.Fprintln(os.Stderr, `  \t      horizontal tab`)
+	fmt.Fprintln(os.Stderr, `  \v      vertical tab`)
+	fmt.Fprintln(os.Stderr, `  \0NNN   byte with octal value NNN (1 to 3 digits)`)
+	fmt.Fprintln(os.Stderr, `  \xHH    byte with hexadecimal value HH (1 to 2 digits)`)
 }
 
 func main() {
-	flag.Parse()
-	echo(flag.Args())
+	if len(os.Args) == 2 && os.Args[1] == "--help" {
+		usage()
+		os.Exit(0)
+	}
+	err := echo(os.Stdout, parseFlags(os.Args[1:]))
+	if err != nil {
+		log.Fatalln(err)
+	}
 }
 
 // echo prints the provided arguments, separated by spaces and terminated by a
-// newline, to the standard output.
-func echo(args []string) {
+// newline, to w. Backslash escapes are interpreted if the "-e" flag is set.
+//
+// The output is written using a single call to w.Write, so that the output of
+// concurrent writers is not interleaved.
+func echo(w io.Writer, args []string) (err error) {
+	buf := new(bytes.Buffer)
 	for i, arg := range args {
-		fmt.Print(arg)
+		if interpretEscapes {
+			s, stop := unescape(arg)
+			buf.WriteString(s)
+			if stop {
+				// "\c" suppresses all further output, including the trailing
+				// newline.
+				_, err = w.Write(buf.Bytes())
+				return err
+			}
+		} else {
+			buf.WriteString(arg)
+		}
 		if i < len(args)-1 {
-			fmt.Print(" ")
+			buf.WriteByte(' ')
 		}
 	}
 
 	if !suppressNewline {
 		// Output trailing newline if "-n" flag isn't set.
-		fmt.Println()
+		buf.WriteByte('\n')
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// unescape returns s with its backslash escapes interpreted. The returned stop
+// value is true if s contains a "\c" escape, in which case the returned string
+// holds the output up to but not including the escape.
+func unescape(s string) (out string, stop bool) {
+	buf := new(strings.Builder)
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			buf.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch c := s[i]; c {
+		case '\\':
+			buf.WriteByte('\\')
+		case 'a':
+			buf.WriteByte('\a')
+		case 'b':
+			buf.WriteByte('\b')
+		case 'c':
+			return buf.String(), true
+		case 'e':
+			buf.WriteByte('\x1B')
+		case 'f':
+			buf.WriteByte('\f')
+		case 'n':
+			buf.WriteByte('\n')
+		case 'r':
+			buf.WriteByte('\r')
+		case 't':
+			buf.WriteByte('\t')
+		case 'v':
+			buf.WriteByte('\v')
+		case '0':
+			// \0NNN, where NNN is zero to three octal digits.
+			v, n := parseDigits(s[i+1:], 8, 3)
+			buf.WriteByte(byte(v))
+			i += n
+		case 'x':
+			// \xHH, where HH is one or two hexadecimal digits.
+			v, n := parseDigits(s[i+1:], 16, 2)
+			if n == 0 {
+				// Not an escape; output verbatim.
+				buf.WriteString(`\x`)
+				break
+			}
+			buf.WriteByte(byte(v))
+			i += n
+		default:
+			// Unknown escape; output verbatim.
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String(), false
+}
+
+// parseDigits parses at most max leading digits of s in the given base. It
+// returns the parsed value and the number of digits consumed.
+func parseDigits(s string, base, max int) (v, n int) {
+	for n < max && n < len(s) {
+		d := digitVal(s[n])
+		if d >= base {
+			break
+		}
+		v = v*base + d
+		n++
+	}
+	return v, n
+}
+
+// digitVal returns the numeric value of the hexadecimal digit c, or 16 if c is
+// not a hexadecimal digit.
+func digitVal(c byte) int {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c - '0')
+	case 'a' <= c && c <= 'f':
+		return int(c-'a') + 10
+	case 'A' <= c && c <= 'F':
+		return int(c-'A') + 10
 	}
+	return 16
 }
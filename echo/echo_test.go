@@ -0,0 +1,92 @@
+package main
+
+import "strings"
+import "testing"
+
+func TestEcho(t *testing.T) {
+	golden := []struct {
+		args    []string
+		escapes bool
+		noNL    bool
+		want    string
+	}{
+		{want: "\n"},
+		{args: []string{"a", "b c"}, want: "a b c\n"},
+		{args: []string{"a", "b"}, noNL: true, want: "a b"},
+		{args: []string{`a\tb`}, want: "a\\tb\n"},
+		{args: []string{`a\tb`}, escapes: true, want: "a\tb\n"},
+		{args: []string{`a\cb`, "c"}, escapes: true, want: "a"},
+		{args: []string{"a", `b\c`}, escapes: true, want: "a b"},
+		{args: []string{`\0101`, `\101`}, escapes: true, noNL: true, want: `A \101`},
+	}
+	defer func() {
+		interpretEscapes, suppressNewline = false, false
+	}()
+	for _, g := range golden {
+		interpretEscapes, suppressNewline = g.escapes, g.noNL
+		buf := new(strings.Builder)
+		err := echo(buf, g.args)
+		if err != nil {
+			t.Errorf("echo(%q): unexpected error; %v", g.args, err)
+			continue
+		}
+		if got := buf.String(); got != g.want {
+			t.Errorf("echo(%q) with -e=%v -n=%v: expected %q, got %q", g.args, g.escapes, g.noNL, g.want, got)
+		}
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	golden := []struct {
+		args    []string
+		escapes bool
+		noNL    bool
+		want    []string
+	}{
+		{args: []string{"a"}, want: []string{"a"}},
+		{args: []string{"-ne", `a	b`}, escapes: true, noNL: true, want: []string{`a	b`}},
+		{args: []string{"-n", "-e", "a"}, escapes: true, noNL: true, want: []string{"a"}},
+		{args: []string{"-e", "-E", "a"}, want: []string{"a"}},
+		{args: []string{"-Ee", "a"}, escapes: true, want: []string{"a"}},
+		{args: []string{"-nx", "a"}, want: []string{"-nx", "a"}},
+		{args: []string{"-", "-n"}, want: []string{"-", "-n"}},
+		{args: []string{"--", "-n"}, want: []string{"--", "-n"}},
+		{args: []string{"a", "-n"}, want: []string{"a", "-n"}},
+		{args: []string{"-n", "-n"}, noNL: true, want: nil},
+	}
+	defer func() {
+		interpretEscapes, suppressNewline = false, false
+	}()
+	for _, g := range golden {
+		interpretEscapes, suppressNewline = false, false
+		got := parseFlags(g.args)
+		if strings.Join(got, "|") != strings.Join(g.want, "|") || len(got) != len(g.want) {
+			t.Errorf("parseFlags(%q): expected arguments %q, got %q", g.args, g.want, got)
+		}
+		if interpretEscapes != g.escapes || suppressNewline != g.noNL {
+			t.Errorf("parseFlags(%q): expected -e=%v -n=%v, got -e=%v -n=%v", g.args, g.escapes, g.noNL, interpretEscapes, suppressNewline)
+		}
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	golden := []struct {
+		in   string
+		want string
+		stop bool
+	}{
+		{in: `plain`, want: "plain"},
+		{in: `\\\a\b\e\f\n\r\t\v`, want: "\\\a\b\x1B\f\n\r\t\v"},
+		{in: `\0101\0\00\01011`, want: "A\x00\x00A1"},
+		{in: `\101`, want: `\101`},
+		{in: `\x41\x4A1\x\xg`, want: "AJ1\\x\\xg"},
+		{in: `\z\`, want: `\z\`},
+		{in: `ab\cde`, want: "ab", stop: true},
+	}
+	for _, g := range golden {
+		got, stop := unescape(g.in)
+		if got != g.want || stop != g.stop {
+			t.Errorf("unescape(%q): expected %q, %v, got %q, %v", g.in, g.want, g.stop, got, stop)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import "errors"
+import "fmt"
+import "net"
+import "strconv"
+import "strings"
+
+// localAddr is the local address of outgoing connections, as specified by the
+// "-s" and "-p" flags; or nil if chosen by the system.
+var localAddr net.Addr
+
+// initAddrFlags validates the "-s", "-p", "-4" and "-6" flags. The address
+// family of the "-4" and "-6" flags is applied to the protocol of the "-proto"
+// flag, and the local address of outgoing connections is resolved.
+func initAddrFlags() (err error) {
+	if flagIPv4 && flagIPv6 {
+		return errors.New("nc: -4 and -6 are mutually exclusive")
+	}
+	bind := flagSource != "" || flagPort != 0
+	if !bind && !flagIPv4 && !flagIPv6 {
+		return nil
+	}
+	switch {
+	case isUnixProto(flagProto):
+		return errors.New("nc: -s, -p, -4 and -6 are incompatible with Unix domain sockets")
+	case bind && flagListen:
+		return errors.New("nc: -s and -p are incompatible with -l; specify the local address as ADDR")
+	case flagPort != 0 && flagZero:
+		return errors.New("nc: -p is incompatible with -z")
+	case flagPort < 0 || flagPort > 65535:
+		return fmt.Errorf("nc: invalid port %d", flagPort)
+	}
+
+	// Force address family.
+	family := ""
+	switch {
+	case flagIPv4:
+		family = "4"
+	case flagIPv6:
+		family = "6"
+	}
+	if family != "" {
+		flagProto, err = forceFamily(flagProto, family)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Resolve local address.
+	if !bind {
+		return nil
+	}
+	ip := net.ParseIP(flagSource)
+	switch {
+	case flagSource != "" && ip == nil:
+		return fmt.Errorf("nc: invalid source address %q", flagSource)
+	case ip != nil && flagIPv4 && ip.To4() == nil:
+		return fmt.Errorf("nc: -4 is incompatible with the IPv6 source address %s", ip)
+	case ip != nil && flagIPv6 && ip.To4() != nil:
+		return fmt.Errorf("nc: -6 is incompatible with the IPv4 source address %s", ip)
+	}
+	hostport := net.JoinHostPort(flagSource, strconv.Itoa(flagPort))
+	switch {
+	case strings.HasPrefix(flagProto, "tcp"):
+		localAddr, err = net.ResolveTCPAddr(flagProto, hostport)
+	case strings.HasPrefix(flagProto, "udp"):
+		localAddr, err = net.ResolveUDPAddr(flagProto, hostport)
+	case flagPort == 0:
+		localAddr, err = net.ResolveIPAddr(ipNetwork(flagProto), flagSource)
+	default:
+		return fmt.Errorf("nc: -p is incompatible with -proto %s", flagProto)
+	}
+	return err
+}
+
+// forceFamily returns the protocol of the provided address family ("4" or
+// "6") corresponding to proto.
+func forceFamily(proto, family string) (string, error) {
+	network, rest := proto, ""
+	if pos := strings.IndexByte(proto, ':'); pos != -1 {
+		// IP protocols, such as "ip:icmp".
+		network, rest = proto[:pos], proto[pos:]
+	}
+	switch network {
+	case "tcp", "udp", "ip":
+		return network + family + rest, nil
+	case "tcp" + family, "udp" + family, "ip" + family:
+		return proto, nil
+	}
+	return "", fmt.Errorf("nc: -%s is incompatible with -proto %s", family, proto)
+}
+
+// ipNetwork returns the network of the IP protocol proto (e.g. "ip4" for
+// "ip4:icmp").
+func ipNetwork(proto string) string {
+	if pos := strings.IndexByte(proto, ':'); pos != -1 {
+		return proto[:pos]
+	}
+	return proto
+}
+
+// newDialer returns a dialer of outgoing connections, which uses the timeout
+// of the "-w" flag, the keep-alive period of the "-keepalive" flag and the
+// local address of the "-s" and "-p" flags.
+func newDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:   waitTimeout(),
+		KeepAlive: flagKeepAlive,
+		LocalAddr: localAddr,
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import "bytes"
+import "fmt"
+
+// A relay relays the data written to it to all clients of a connection list
+// except the sender.
+type relay struct {
+	// Sending client.
+	c *client
+	// Connected clients.
+	cl *connList
+	// Prefix of each line of relayed data; and whether the next byte written
+	// starts a new line.
+	prefix    []byte
+	lineStart bool
+}
+
+// newRelay returns a new relay of the data sent by c to the other clients of
+// cl. Lines are prefixed with the address of the sender if the "-broker-prefix"
+// flag is set.
+func newRelay(c *client, cl *connList) *relay {
+	r := &relay{c: c, cl: cl, lineStart: true}
+	if flagBrokerPrefix {
+		r.prefix = []byte(fmt.Sprintf("[%s] ", c.RemoteAddr()))
+	}
+	return r
+}
+
+// Write relays p to all clients except the sender. It never fails, so that a
+// failing client does not affect the others.
+func (r *relay) Write(p []byte) (n int, err error) {
+	data := p
+	if r.prefix != nil {
+		data = r.prefixLines(p)
+	}
+	r.cl.Broadcast(data, r.c)
+	return len(p), nil
+}
+
+// prefixLines returns a copy of p with the prefix of the relay inserted at the
+// start of each line.
+func (r *relay) prefixLines(p []byte) []byte {
+	buf := new(bytes.Buffer)
+	for len(p) > 0 {
+		if r.lineStart {
+			buf.Write(r.prefix)
+		}
+		line := p
+		if pos := bytes.IndexByte(p, '\n'); pos != -1 {
+			line = p[:pos+1]
+		}
+		buf.Write(line)
+		r.lineStart = line[len(line)-1] == '\n'
+		p = p[len(line):]
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,114 @@
+package main
+
+import "bytes"
+import "fmt"
+import "io"
+import "net"
+import "os"
+import "sync"
+import "time"
+
+// captureFile is the file of the "-o" flag, to which traffic is logged.
+var captureFile struct {
+	sync.Mutex
+	f *os.File
+}
+
+// openCapture creates the file of the "-o" flag, to which traffic is logged.
+// The file is closed on exit.
+func openCapture(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	captureFile.f = f
+	atExit(func() {
+		captureFile.Lock()
+		defer captureFile.Unlock()
+		f.Close()
+	})
+	return nil
+}
+
+// A capture logs the traffic of one direction of a connection to the file of
+// the "-o" flag. Each chunk of data is logged as a line containing a timestamp,
+// the direction of the traffic (">" for sent and "<" for received data) and
+// the address of the peer, followed by a hex dump of the chunk in the canonical
+// hex+ASCII layout of hexdump -C. Offsets are counted from the start of the
+// connection in the given direction.
+type capture struct {
+	// Direction of the traffic.
+	dir string
+	// Address of the peer.
+	peer net.Addr
+	// Offset of the next chunk.
+	off int64
+}
+
+// newCapture returns a new capture of the traffic of conn in the provided
+// direction, or nil if no traffic is logged.
+func newCapture(dir string, peer net.Addr) *capture {
+	if captureFile.f == nil {
+		return nil
+	}
+	return &capture{dir: dir, peer: peer}
+}
+
+// Write logs p as a hex dump.
+func (c *capture) Write(p []byte) (n int, err error) {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "# %s %s %s\n", time.Now().Format("2006-01-02T15:04:05.000000Z07:00"), c.dir, c.peer)
+	for i := 0; i < len(p); i += 16 {
+		line := p[i:]
+		if len(line) > 16 {
+			line = line[:16]
+		}
+		fmt.Fprintf(buf, "%08x ", c.off+int64(i))
+		for j := 0; j < 16; j++ {
+			if j%8 == 0 {
+				buf.WriteByte(' ')
+			}
+			if j < len(line) {
+				fmt.Fprintf(buf, "%02x ", line[j])
+			} else {
+				buf.WriteString("   ")
+			}
+		}
+		buf.WriteString(" |")
+		for _, b := range line {
+			if b < 0x20 || b > 0x7E {
+				b = '.'
+			}
+			buf.WriteByte(b)
+		}
+		buf.WriteString("|\n")
+	}
+	c.off += int64(len(p))
+	fmt.Fprintf(buf, "%08x\n", c.off)
+
+	captureFile.Lock()
+	defer captureFile.Unlock()
+	_, err = captureFile.f.Write(buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// captureReader returns a reader of r which logs the data read as traffic of
+// the provided direction, if the "-o" flag is set.
+func captureReader(r io.Reader, dir string, peer net.Addr) io.Reader {
+	if c := newCapture(dir, peer); c != nil {
+		return io.TeeReader(r, c)
+	}
+	return r
+}
+
+// captureWriter returns a writer to w which logs the data written as traffic of
+// the provided direction, if the "-o" flag is set.
+func captureWriter(w io.Writer, dir string, peer net.Addr) io.Writer {
+	if c := newCapture(dir, peer); c != nil {
+		return io.MultiWriter(w, c)
+	}
+	return w
+}
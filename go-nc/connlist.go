@@ -1,42 +1,294 @@
 package main
 
+import "errors"
+import "log"
 import "net"
 import "sync"
+import "time"
 
-// connList is a list of connections that can safely be used concurrently.
+// queueLimit is the maximum number of bytes of pending writes of a client.
+const queueLimit = 8 << 20
+
+// errQueueFull is the error of clients evicted because their write queue is
+// full.
+var errQueueFull = errors.New("write queue full")
+
+// connList is a list of client connections that can safely be used
+// concurrently.
+//
+// Writes to each client are queued and performed by a dedicated goroutine, so
+// that a slow client never blocks writes to the other clients. Clients are
+// evicted from the list and disconnected when a write fails or blocks for
+// longer than the write timeout, or when their write queue exceeds queueLimit
+// bytes. Writers may wait for the fastest client to make progress with
+// WaitReady, so that a single slow client receives all data, while clients
+// which fall too far behind the fastest client are evicted.
 type connList struct {
 	sync.Mutex
-	m map[string]net.Conn
+	m map[*client]bool
+	// eof is true once the writing side of all clients is shut down.
+	eof bool
+	// Signalled when a client makes progress or is removed.
+	progress *sync.Cond
 }
 
 // NewConnList returns a new connection list.
 func NewConnList() (cl *connList) {
 	cl = &connList{
-		m: make(map[string]net.Conn),
+		m: make(map[*client]bool),
 	}
+	cl.progress = sync.NewCond(cl)
 	return cl
 }
 
-// Add adds the specified connection.
-func (cl *connList) Add(addr string, conn net.Conn) {
+// Add adds the specified connection, and returns its client. Clients are
+// identified by their connection rather than by their address, as the
+// addresses of peers, such as the clients of Unix domain sockets, need not be
+// unique.
+func (cl *connList) Add(conn net.Conn) *client {
+	c := &client{
+		Conn:     conn,
+		cl:       cl,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		timeout:  flagWriteTimeout,
+		sent:     newCapture(">", conn.RemoteAddr()),
+		received: newCapture("<", conn.RemoteAddr()),
+	}
+	cl.Lock()
+	cl.m[c] = true
+	eof := cl.eof
+	cl.Unlock()
+	if eof {
+		// Shut down the writing side of clients connecting after EOF.
+		c.enqueue(nil)
+	}
+	go c.writeLoop()
+	return c
+}
+
+// CloseWrite shuts down the writing side of all clients, including clients
+// added later, once their queued writes have been performed.
+func (cl *connList) CloseWrite() {
+	cl.Lock()
+	cl.eof = true
+	cl.Unlock()
+	for _, c := range cl.Clients() {
+		err := c.CloseWrite()
+		if err != nil && err != net.ErrClosed {
+			log.Println(err)
+		}
+	}
+}
+
+// Del removes the specified client.
+func (cl *connList) Del(c *client) {
 	cl.Lock()
 	defer cl.Unlock()
-	cl.m[addr] = conn
+	delete(cl.m, c)
+	cl.progress.Broadcast()
 }
 
-// Del removes the specified connection.
-func (cl *connList) Del(addr string) {
+// Clients returns all clients.
+func (cl *connList) Clients() (clients []*client) {
 	cl.Lock()
 	defer cl.Unlock()
-	delete(cl.m, addr)
+	for c := range cl.m {
+		clients = append(clients, c)
+	}
+	return clients
 }
 
-// Conns returns all connections.
-func (cl *connList) Conns() (conns []net.Conn) {
+// Broadcast queues p to be written to all clients except the provided client,
+// which may be nil. It never blocks; clients whose write queue is full are
+// evicted.
+func (cl *connList) Broadcast(p []byte, except *client) {
+	// The queued buffer is shared by all clients, and never modified.
+	buf := append([]byte(nil), p...)
+	for _, c := range cl.Clients() {
+		if c == except {
+			continue
+		}
+		c.enqueue(buf)
+	}
+}
+
+// WaitReady waits until the write queue of at least one client is less than
+// half full, or the list is empty. Writers which wait before each broadcast
+// therefore proceed at the pace of the fastest client.
+func (cl *connList) WaitReady() {
 	cl.Lock()
 	defer cl.Unlock()
-	for _, conn := range cl.m {
-		conns = append(conns, conn)
+	for !cl.ready() {
+		cl.progress.Wait()
+	}
+}
+
+// ready reports whether the write queue of at least one client is less than
+// half full, or the list is empty. The caller must hold the lock of cl.
+func (cl *connList) ready() bool {
+	if len(cl.m) == 0 {
+		return true
+	}
+	for c := range cl.m {
+		c.mu.Lock()
+		queued := c.queued
+		c.mu.Unlock()
+		if queued < queueLimit/2 {
+			return true
+		}
+	}
+	return false
+}
+
+// A client is a connection of a connection list, with a queue of pending
+// writes.
+type client struct {
+	net.Conn
+	// Connection list of the client.
+	cl *connList
+	// Pending writes, and their total size in bytes; a nil buffer shuts down
+	// the writing side of the connection.
+	mu     sync.Mutex
+	queue  [][]byte
+	queued int
+	// Notifies the write loop of pending writes.
+	wake chan struct{}
+	// Closed when the client is closed.
+	done chan struct{}
+	once sync.Once
+	// Write timeout of the client; or zero if writes never time out.
+	timeout time.Duration
+	// Captures of the sent and received traffic of the client; or nil if no
+	// traffic is logged.
+	sent, received *capture
+}
+
+// Write queues a copy of p to be written to the client.
+func (c *client) Write(p []byte) (n int, err error) {
+	err = c.enqueue(append([]byte(nil), p...))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// CloseWrite shuts down the writing side of the connection, once all queued
+// writes have been performed.
+func (c *client) CloseWrite() error {
+	return c.enqueue(nil)
+}
+
+// Close disconnects the client, discarding any queued writes, and removes it
+// from its connection list.
+func (c *client) Close() (err error) {
+	err = net.ErrClosed
+	c.once.Do(func() {
+		close(c.done)
+		c.cl.Del(c)
+		err = c.Conn.Close()
+	})
+	return err
+}
+
+// closed reports whether the client has been closed.
+func (c *client) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// enqueue adds buf to the write queue of the client, without blocking. The
+// client is evicted if its write queue would exceed queueLimit bytes.
+func (c *client) enqueue(buf []byte) error {
+	c.mu.Lock()
+	if c.closed() {
+		c.mu.Unlock()
+		return net.ErrClosed
+	}
+	if c.queued+len(buf) > queueLimit {
+		c.mu.Unlock()
+		c.evict(errQueueFull)
+		return errQueueFull
+	}
+	c.queue = append(c.queue, buf)
+	c.queued += len(buf)
+	c.mu.Unlock()
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// dequeue removes and returns the next pending write of the client. The
+// returned ok value is false if the write queue is empty.
+func (c *client) dequeue() (buf []byte, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.queue) == 0 {
+		return nil, false
+	}
+	buf = c.queue[0]
+	c.queue[0] = nil
+	c.queue = c.queue[1:]
+	return buf, true
+}
+
+// written records that buf has been written, and notifies writers waiting for
+// progress.
+func (c *client) written(buf []byte) {
+	c.mu.Lock()
+	c.queued -= len(buf)
+	c.mu.Unlock()
+	c.cl.Lock()
+	c.cl.progress.Broadcast()
+	c.cl.Unlock()
+}
+
+// evict disconnects the client because of err.
+func (c *client) evict(err error) {
+	if c.closed() {
+		return
+	}
+	log.Printf("nc: %s: evicting client; %v", c.RemoteAddr(), err)
+	c.Close()
+}
+
+// writeLoop performs the queued writes of the client until it is closed. The
+// client is evicted if a write fails or times out.
+func (c *client) writeLoop() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.wake:
+		}
+		for !c.closed() {
+			buf, ok := c.dequeue()
+			if !ok {
+				break
+			}
+			var err error
+			if buf == nil {
+				err = closeWrite(c.Conn)
+			} else {
+				if c.timeout > 0 {
+					c.Conn.SetWriteDeadline(time.Now().Add(c.timeout))
+				}
+				_, err = c.Conn.Write(buf)
+				if err == nil && c.sent != nil {
+					c.sent.Write(buf)
+				}
+			}
+			if err != nil {
+				c.evict(err)
+				return
+			}
+			c.written(buf)
+		}
 	}
-	return conns
 }
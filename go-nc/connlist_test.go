@@ -0,0 +1,194 @@
+package main
+
+import "bytes"
+import "encoding/binary"
+import "io"
+import "net"
+import "sync"
+import "testing"
+import "time"
+
+// msgSize is the size of broadcast test messages.
+const msgSize = 8
+
+// broadcastMessages broadcasts n numbered messages of msgSize bytes to the
+// clients of cl, and returns the expected data received by each client.
+func broadcastMessages(cl *connList, n int) []byte {
+	want := new(bytes.Buffer)
+	for i := 0; i < n; i++ {
+		msg := binary.BigEndian.AppendUint64(nil, uint64(i))
+		want.Write(msg)
+		cl.Broadcast(msg, nil)
+	}
+	return want.Bytes()
+}
+
+func TestBroadcast(t *testing.T) {
+	defer func(d time.Duration) { flagWriteTimeout = d }(flagWriteTimeout)
+	flagWriteTimeout = 500 * time.Millisecond
+
+	const (
+		numClients  = 20
+		numMessages = 1024
+	)
+	cl := NewConnList()
+	var peers []net.Conn
+	for i := 0; i < numClients; i++ {
+		conn, peer := net.Pipe()
+		defer peer.Close()
+		cl.Add(conn)
+		peers = append(peers, peer)
+	}
+	// The peer of the stalled client never reads.
+	stalled, stalledPeer := net.Pipe()
+	defer stalledPeer.Close()
+	s := cl.Add(stalled)
+
+	var wg sync.WaitGroup
+	received := make([][]byte, numClients)
+	for i, peer := range peers {
+		wg.Add(1)
+		go func(i int, peer net.Conn) {
+			defer wg.Done()
+			// net.Pipe does not support half-closing, and reports no EOF.
+			received[i] = make([]byte, numMessages*msgSize)
+			n, _ := io.ReadFull(peer, received[i])
+			received[i] = received[i][:n]
+		}(i, peer)
+	}
+	want := broadcastMessages(cl, numMessages)
+
+	// The stalled client is evicted once a write times out, which unblocks
+	// the broadcast.
+	select {
+	case <-s.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stalled client not evicted")
+	}
+	for _, c := range cl.Clients() {
+		if c == s {
+			t.Error("stalled client still in list")
+		}
+	}
+	if n := len(cl.Clients()); n != numClients {
+		t.Errorf("expected %d clients, got %d", numClients, n)
+	}
+
+	wg.Wait()
+	for i, got := range received {
+		if !bytes.Equal(got, want) {
+			t.Errorf("client %d: expected %d bytes, got %d bytes", i, len(want), len(got))
+		}
+	}
+	for _, c := range cl.Clients() {
+		c.Close()
+	}
+}
+
+func TestBroadcastSlowClient(t *testing.T) {
+	defer func(d time.Duration) { flagWriteTimeout = d }(flagWriteTimeout)
+	flagWriteTimeout = 0
+
+	const numMessages = 1024
+	cl := NewConnList()
+	fast, fastPeer := net.Pipe()
+	defer fastPeer.Close()
+	slow, slowPeer := net.Pipe()
+	defer slowPeer.Close()
+	cl.Add(fast)
+	cl.Add(slow)
+	defer func() {
+		for _, c := range cl.Clients() {
+			c.Close()
+		}
+	}()
+
+	// The fast client receives all messages while the slow client has not
+	// read anything yet.
+	fastDone := make(chan []byte)
+	go func() {
+		got := make([]byte, numMessages*msgSize)
+		n, _ := io.ReadFull(fastPeer, got)
+		fastDone <- got[:n]
+	}()
+	want := broadcastMessages(cl, numMessages)
+	select {
+	case got := <-fastDone:
+		if !bytes.Equal(got, want) {
+			t.Errorf("fast client: expected %d bytes, got %d bytes", len(want), len(got))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("fast client blocked by slow client")
+	}
+
+	// The slow client receives all messages once it starts reading.
+	got := make([]byte, numMessages*msgSize)
+	n, _ := io.ReadFull(slowPeer, got)
+	if !bytes.Equal(got[:n], want) {
+		t.Errorf("slow client: expected %d bytes, got %d bytes", len(want), n)
+	}
+}
+
+func TestBroadcastQueueFull(t *testing.T) {
+	defer func(d time.Duration) { flagWriteTimeout = d }(flagWriteTimeout)
+	flagWriteTimeout = 0
+
+	cl := NewConnList()
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	c := cl.Add(conn)
+
+	// A client which never reads is evicted once its write queue is full,
+	// without blocking the broadcast.
+	done := make(chan bool)
+	go func() {
+		buf := make([]byte, 64*1024)
+		for i := 0; i <= queueLimit/len(buf)+1; i++ {
+			cl.Broadcast(buf, nil)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("broadcast blocked by client with full write queue")
+	}
+	if !c.closed() {
+		t.Error("client with full write queue not evicted")
+	}
+	if n := len(cl.Clients()); n != 0 {
+		t.Errorf("expected no clients, got %d", n)
+	}
+}
+
+func TestWaitReady(t *testing.T) {
+	defer func(d time.Duration) { flagWriteTimeout = d }(flagWriteTimeout)
+	flagWriteTimeout = 0
+
+	cl := NewConnList()
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	c := cl.Add(conn)
+	defer c.Close()
+
+	// Fill the write queue of the only client to half its limit.
+	cl.Broadcast(make([]byte, queueLimit/2), nil)
+	ready := make(chan bool)
+	go func() {
+		cl.WaitReady()
+		close(ready)
+	}()
+	select {
+	case <-ready:
+		t.Fatal("WaitReady returned while the write queue is half full")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Reading lets the client make progress.
+	go io.Copy(io.Discard, peer)
+	select {
+	case <-ready:
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitReady did not return once the client made progress")
+	}
+}
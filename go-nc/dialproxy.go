@@ -0,0 +1,253 @@
+package main
+
+import "bufio"
+import "encoding/base64"
+import "encoding/binary"
+import "errors"
+import "fmt"
+import "io"
+import "net"
+import "net/http"
+import "strconv"
+import "strings"
+import "syscall"
+import "time"
+
+// dialProxy connects to addr through the proxy specified by the "-x" flag,
+// using the proxy protocol specified by the "-X" flag.
+func dialProxy(addr string) (conn net.Conn, err error) {
+	conn, err = newDialer().Dial(flagProto, flagProxy)
+	if err != nil {
+		return nil, err
+	}
+	if timeout := waitTimeout(); timeout > 0 {
+		// Time out the proxy handshake.
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+	switch flagProxyProto {
+	case "5":
+		err = socks5Connect(conn, addr)
+	case "connect":
+		var c net.Conn
+		c, err = httpConnect(conn, addr)
+		if err == nil {
+			conn = c
+		}
+	default:
+		err = fmt.Errorf("nc: unknown proxy protocol %q", flagProxyProto)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// proxyAuth returns the user name and password specified by the "-proxy-auth"
+// flag.
+func proxyAuth() (user, pass string, ok bool) {
+	if flagProxyAuth == "" {
+		return "", "", false
+	}
+	pos := strings.IndexByte(flagProxyAuth, ':')
+	if pos == -1 {
+		return flagProxyAuth, "", true
+	}
+	return flagProxyAuth[:pos], flagProxyAuth[pos+1:], true
+}
+
+// SOCKS5 protocol constants, as specified by RFC 1928 and RFC 1929.
+const (
+	socks5Version = 0x05
+	// Authentication methods.
+	socks5NoAuth       = 0x00
+	socks5UserPassAuth = 0x02
+	socks5NoAcceptable = 0xFF
+	// Version of the username/password authentication.
+	socks5UserPassVersion = 0x01
+	// Commands.
+	socks5CmdConnect = 0x01
+	// Address types.
+	socks5IPv4   = 0x01
+	socks5Domain = 0x03
+	socks5IPv6   = 0x04
+)
+
+// socks5Replies maps from SOCKS5 reply codes to their description.
+var socks5Replies = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// socks5Connect requests the SOCKS5 proxy of conn to connect to addr,
+// authenticating with the user name and password of the "-proxy-auth" flag if
+// specified.
+func socks5Connect(conn net.Conn, addr string) (err error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("nc: invalid port %q", portStr)
+	}
+
+	// Negotiate authentication method.
+	user, pass, auth := proxyAuth()
+	methods := []byte{socks5NoAuth}
+	if auth {
+		methods = append(methods, socks5UserPassAuth)
+	}
+	_, err = conn.Write(append([]byte{socks5Version, byte(len(methods))}, methods...))
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 2)
+	_, err = io.ReadFull(conn, buf)
+	if err != nil {
+		return err
+	}
+	if buf[0] != socks5Version {
+		return fmt.Errorf("nc: invalid SOCKS version %d of proxy", buf[0])
+	}
+	switch buf[1] {
+	case socks5NoAuth:
+	case socks5UserPassAuth:
+		if !auth {
+			return errors.New("nc: SOCKS proxy requires authentication")
+		}
+		if len(user) > 255 || len(pass) > 255 {
+			return errors.New("nc: SOCKS user name or password too long")
+		}
+		req := []byte{socks5UserPassVersion, byte(len(user))}
+		req = append(req, user...)
+		req = append(req, byte(len(pass)))
+		req = append(req, pass...)
+		_, err = conn.Write(req)
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadFull(conn, buf)
+		if err != nil {
+			return err
+		}
+		if buf[1] != 0 {
+			return errors.New("nc: SOCKS proxy authentication failed")
+		}
+	case socks5NoAcceptable:
+		return errors.New("nc: no acceptable SOCKS authentication method")
+	default:
+		return fmt.Errorf("nc: unsupported SOCKS authentication method %d", buf[1])
+	}
+
+	// Request connection.
+	req := []byte{socks5Version, socks5CmdConnect, 0}
+	switch ip := net.ParseIP(host); {
+	case ip == nil:
+		if len(host) > 255 {
+			return fmt.Errorf("nc: host name %q too long", host)
+		}
+		req = append(req, socks5Domain, byte(len(host)))
+		req = append(req, host...)
+	case ip.To4() != nil:
+		req = append(req, socks5IPv4)
+		req = append(req, ip.To4()...)
+	default:
+		req = append(req, socks5IPv6)
+		req = append(req, ip.To16()...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	_, err = conn.Write(req)
+	if err != nil {
+		return err
+	}
+
+	// Read reply, and skip the bound address.
+	buf = make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	if err != nil {
+		return err
+	}
+	if buf[1] == 0x05 {
+		// Report refused connections as such, for the exit status.
+		return fmt.Errorf("nc: SOCKS proxy: connection to %s failed; %w", addr, syscall.ECONNREFUSED)
+	}
+	if buf[1] != 0 {
+		msg, ok := socks5Replies[buf[1]]
+		if !ok {
+			msg = fmt.Sprintf("unknown error %d", buf[1])
+		}
+		return fmt.Errorf("nc: SOCKS proxy: connection to %s failed; %s", addr, msg)
+	}
+	var n int
+	switch buf[3] {
+	case socks5IPv4:
+		n = net.IPv4len
+	case socks5IPv6:
+		n = net.IPv6len
+	case socks5Domain:
+		_, err = io.ReadFull(conn, buf[:1])
+		if err != nil {
+			return err
+		}
+		n = int(buf[0])
+	default:
+		return fmt.Errorf("nc: invalid SOCKS address type %d", buf[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, n+2))
+	return err
+}
+
+// httpConnect requests the HTTP proxy of conn to connect to addr, using the
+// CONNECT method. Basic authentication is used if the "-proxy-auth" flag is
+// specified. The returned connection holds any data read past the response of
+// the proxy.
+func httpConnect(conn net.Conn, addr string) (net.Conn, error) {
+	req := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", addr, addr)
+	if user, pass, ok := proxyAuth(); ok {
+		cred := base64.StdEncoding.EncodeToString([]byte(user + ":" + pass))
+		req += fmt.Sprintf("Proxy-Authorization: Basic %s\r\n", cred)
+	}
+	req += "\r\n"
+	_, err := io.WriteString(conn, req)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("nc: HTTP proxy: connection to %s failed; %s", addr, resp.Status)
+	}
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// A bufferedConn is a network connection with buffered reads.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// Read reads data from the connection.
+func (c *bufferedConn) Read(p []byte) (n int, err error) {
+	return c.r.Read(p)
+}
+
+// CloseWrite shuts down the writing side of the connection, if supported by
+// the underlying connection.
+func (c *bufferedConn) CloseWrite() error {
+	return closeWrite(c.Conn)
+}
@@ -0,0 +1,273 @@
+package main
+
+import "bufio"
+import "encoding/base64"
+import "encoding/binary"
+import "fmt"
+import "io"
+import "net"
+import "net/http"
+import "strconv"
+import "strings"
+import "testing"
+import "time"
+
+// serve accepts connections on a new loopback listener, and handles each with
+// handle. It returns the address of the listener.
+func serve(t *testing.T, handle func(conn net.Conn)) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// echoTarget returns the address of a server which greets each client, and
+// then echoes the data it receives.
+func echoTarget(t *testing.T) string {
+	return serve(t, func(conn net.Conn) {
+		io.WriteString(conn, "hello\n")
+		io.Copy(conn, conn)
+	})
+}
+
+// pipeConns copies data between a and b in both directions, until either side
+// is closed.
+func pipeConns(a, b net.Conn) {
+	go io.Copy(a, b)
+	io.Copy(b, a)
+}
+
+// socks5Proxy returns the address of a stand-in SOCKS5 proxy. If user is not
+// empty, the proxy requires authentication with user and pass. Connection
+// requests fail with the reply code of fail if it is not zero.
+func socks5Proxy(t *testing.T, user, pass string, fail byte) string {
+	return serve(t, func(conn net.Conn) {
+		br := bufio.NewReader(conn)
+		hdr := make([]byte, 2)
+		if _, err := io.ReadFull(br, hdr); err != nil {
+			return
+		}
+		methods := make([]byte, hdr[1])
+		if _, err := io.ReadFull(br, methods); err != nil {
+			return
+		}
+		if user == "" {
+			conn.Write([]byte{socks5Version, socks5NoAuth})
+		} else {
+			if !strings.ContainsRune(string(methods), socks5UserPassAuth) {
+				conn.Write([]byte{socks5Version, socks5NoAcceptable})
+				return
+			}
+			conn.Write([]byte{socks5Version, socks5UserPassAuth})
+			// Read username/password request.
+			var fields [2]string
+			if _, err := br.ReadByte(); err != nil {
+				return
+			}
+			for i := range fields {
+				n, err := br.ReadByte()
+				if err != nil {
+					return
+				}
+				buf := make([]byte, n)
+				if _, err := io.ReadFull(br, buf); err != nil {
+					return
+				}
+				fields[i] = string(buf)
+			}
+			if fields[0] != user || fields[1] != pass {
+				conn.Write([]byte{socks5UserPassVersion, 1})
+				return
+			}
+			conn.Write([]byte{socks5UserPassVersion, 0})
+		}
+
+		// Read connection request.
+		req := make([]byte, 4)
+		if _, err := io.ReadFull(br, req); err != nil {
+			return
+		}
+		var host string
+		switch req[3] {
+		case socks5IPv4, socks5IPv6:
+			ip := make(net.IP, net.IPv4len)
+			if req[3] == socks5IPv6 {
+				ip = make(net.IP, net.IPv6len)
+			}
+			if _, err := io.ReadFull(br, ip); err != nil {
+				return
+			}
+			host = ip.String()
+		case socks5Domain:
+			n, err := br.ReadByte()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, n)
+			if _, err := io.ReadFull(br, buf); err != nil {
+				return
+			}
+			host = string(buf)
+		}
+		port := make([]byte, 2)
+		if _, err := io.ReadFull(br, port); err != nil {
+			return
+		}
+		addr := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+		if fail != 0 {
+			conn.Write([]byte{socks5Version, fail, 0, socks5IPv4, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		target, err := net.Dial("tcp", addr)
+		if err != nil {
+			conn.Write([]byte{socks5Version, 0x05, 0, socks5IPv4, 0, 0, 0, 0, 0, 0})
+			return
+		}
+		defer target.Close()
+		conn.Write([]byte{socks5Version, 0, 0, socks5IPv4, 127, 0, 0, 1, 0, 0})
+		pipeConns(conn, target)
+	})
+}
+
+// httpProxy returns the address of a stand-in HTTP CONNECT proxy. If auth is
+// not empty, the proxy requires basic authentication with the credentials of
+// auth, of the form "USER:PASS".
+func httpProxy(t *testing.T, auth string) string {
+	return serve(t, func(conn net.Conn) {
+		br := bufio.NewReader(conn)
+		req, err := http.ReadRequest(br)
+		if err != nil {
+			return
+		}
+		if req.Method != http.MethodConnect {
+			io.WriteString(conn, "HTTP/1.1 405 Method Not Allowed\r\n\r\n")
+			return
+		}
+		if auth != "" && req.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte(auth)) {
+			io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+			return
+		}
+		target, err := net.Dial("tcp", req.Host)
+		if err != nil {
+			io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+			return
+		}
+		defer target.Close()
+		// The greeting of the target may be received together with the
+		// response.
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		pipeConns(conn, target)
+	})
+}
+
+// proxyFlags holds the values of the proxy flags.
+type proxyFlags struct {
+	proxy, proto, auth string
+}
+
+// set sets the proxy flags, and returns a function which restores their
+// previous values.
+func (f proxyFlags) set() (restore func()) {
+	prev := proxyFlags{proxy: flagProxy, proto: flagProxyProto, auth: flagProxyAuth}
+	flagProxy, flagProxyProto, flagProxyAuth = f.proxy, f.proto, f.auth
+	return func() {
+		flagProxy, flagProxyProto, flagProxyAuth = prev.proxy, prev.proto, prev.auth
+	}
+}
+
+func TestDialProxy(t *testing.T) {
+	target := echoTarget(t)
+	_, port, _ := net.SplitHostPort(target)
+	socks := socks5Proxy(t, "", "", 0)
+	socksAuth := socks5Proxy(t, "user", "secret", 0)
+	socksFail := socks5Proxy(t, "", "", 0x02)
+	socksRefused := socks5Proxy(t, "", "", 0x05)
+	connect := httpProxy(t, "")
+	connectAuth := httpProxy(t, "user:secret")
+
+	golden := []struct {
+		name  string
+		flags proxyFlags
+		addr  string
+		// Substring of the expected error message; or empty on success.
+		err     string
+		refused bool
+	}{
+		{name: "SOCKS5", flags: proxyFlags{proxy: socks, proto: "5"}, addr: target},
+		{name: "SOCKS5 host name", flags: proxyFlags{proxy: socks, proto: "5"}, addr: net.JoinHostPort("localhost", port)},
+		{name: "SOCKS5 auth", flags: proxyFlags{proxy: socksAuth, proto: "5", auth: "user:secret"}, addr: target},
+		{name: "SOCKS5 wrong password", flags: proxyFlags{proxy: socksAuth, proto: "5", auth: "user:wrong"}, addr: target, err: "authentication failed"},
+		{name: "SOCKS5 missing auth", flags: proxyFlags{proxy: socksAuth, proto: "5"}, addr: target, err: "no acceptable SOCKS authentication method"},
+		{name: "SOCKS5 failure", flags: proxyFlags{proxy: socksFail, proto: "5"}, addr: target, err: "connection not allowed by ruleset"},
+		{name: "SOCKS5 refused", flags: proxyFlags{proxy: socksRefused, proto: "5"}, addr: target, err: "connection refused", refused: true},
+		{name: "CONNECT", flags: proxyFlags{proxy: connect, proto: "connect"}, addr: target},
+		{name: "CONNECT auth", flags: proxyFlags{proxy: connectAuth, proto: "connect", auth: "user:secret"}, addr: target},
+		{name: "CONNECT missing auth", flags: proxyFlags{proxy: connectAuth, proto: "connect"}, addr: target, err: "407 Proxy Authentication Required"},
+		{name: "unknown protocol", flags: proxyFlags{proxy: socks, proto: "4"}, addr: target, err: "unknown proxy protocol"},
+	}
+	for _, g := range golden {
+		restore := g.flags.set()
+		conn, err := dialProxy(g.addr)
+		restore()
+		if g.err != "" {
+			if err == nil {
+				conn.Close()
+				t.Errorf("%s: expected error containing %q, got nil", g.name, g.err)
+			} else if !strings.Contains(err.Error(), g.err) {
+				t.Errorf("%s: expected error containing %q, got %q", g.name, g.err, err)
+			} else if isRefused(err) != g.refused {
+				t.Errorf("%s: expected refused %v, got %v", g.name, g.refused, isRefused(err))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error; %v", g.name, err)
+			continue
+		}
+		err = checkEcho(conn)
+		if err != nil {
+			t.Errorf("%s: %v", g.name, err)
+		}
+		conn.Close()
+	}
+}
+
+// checkEcho checks that conn is connected to the echo target, through the
+// greeting of the target and the echo of a message.
+func checkEcho(conn net.Conn) error {
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	br := bufio.NewReader(conn)
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if line != "hello\n" {
+		return fmt.Errorf("expected greeting %q, got %q", "hello\n", line)
+	}
+	_, err = io.WriteString(conn, "ping\n")
+	if err != nil {
+		return err
+	}
+	line, err = br.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if line != "ping\n" {
+		return fmt.Errorf("expected echo %q, got %q", "ping\n", line)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import "errors"
+import "io"
+import "net"
+import "os"
+import "os/exec"
+import "strings"
+import "sync"
+import "time"
+
+// children holds the running child processes, which are killed when the
+// process terminates.
+var children struct {
+	sync.Mutex
+	m map[*os.Process]bool
+}
+
+// hasCommand reports whether a command to execute per connection has been
+// specified by the "-e" or "-c" flags.
+func hasCommand() bool {
+	return flagExec != "" || flagCmd != ""
+}
+
+// command returns the command to execute per connection, as specified by the
+// "-e" or "-c" flags.
+func command() (cmd *exec.Cmd, err error) {
+	switch {
+	case flagExec != "" && flagCmd != "":
+		return nil, errors.New("nc: -e and -c are mutually exclusive")
+	case flagCmd != "":
+		return exec.Command("/bin/sh", "-c", flagCmd), nil
+	}
+	args := strings.Fields(flagExec)
+	if len(args) == 0 {
+		return nil, errors.New("nc: empty command")
+	}
+	return exec.Command(args[0], args[1:]...), nil
+}
+
+// execConn executes the command of the "-e" or "-c" flags with its standard
+// input and output wired to conn. Once the peer has sent EOF, the standard
+// input of the child process is closed; once the child process has closed its
+// standard output, the connection is closed. The child process is killed if
+// the connection fails, or if it is still running after the delay of the "-q"
+// flag once the peer has sent EOF.
+func execConn(conn net.Conn) (err error) {
+	defer conn.Close()
+	cmd, err := command()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+	addChild(cmd.Process)
+	defer delChild(cmd.Process)
+
+	go func() {
+		_, err := io.Copy(stdin, captureReader(recvReader(conn), "<", conn.RemoteAddr()))
+		stdin.Close()
+		if err != nil {
+			// connection failed.
+			cmd.Process.Kill()
+			return
+		}
+		if flagQuit >= 0 {
+			time.AfterFunc(time.Duration(flagQuit)*time.Second, func() {
+				cmd.Process.Kill()
+			})
+		}
+	}()
+	_, err = io.Copy(conn, captureReader(sendReader(stdout), ">", conn.RemoteAddr()))
+	if err != nil {
+		// connection failed.
+		cmd.Process.Kill()
+		stdout.Close()
+	}
+	closeWrite(conn)
+	return cmd.Wait()
+}
+
+// addChild adds p to the running child processes. The first child process
+// registers an exit hook which kills the running child processes.
+func addChild(p *os.Process) {
+	children.Lock()
+	defer children.Unlock()
+	if children.m == nil {
+		children.m = make(map[*os.Process]bool)
+		atExit(killChildren)
+	}
+	children.m[p] = true
+}
+
+// delChild removes p from the running child processes.
+func delChild(p *os.Process) {
+	children.Lock()
+	defer children.Unlock()
+	delete(children.m, p)
+}
+
+// killChildren kills the running child processes.
+func killChildren() {
+	children.Lock()
+	defer children.Unlock()
+	for p := range children.m {
+		p.Kill()
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import "errors"
+import "fmt"
+import "log"
+import "os"
+import "os/signal"
+import "sync"
+import "syscall"
+
+// Exit status codes.
+const (
+	// exitFailure is used for general errors.
+	exitFailure = 1
+	// exitUsage is used for invalid command line arguments, as by the flag
+	// package.
+	exitUsage = 2
+	// exitRefused is used when a connection is refused.
+	exitRefused = 3
+	// exitTimeout is used when a connection times out.
+	exitTimeout = 4
+)
+
+// exitHooks holds the functions run before the process terminates.
+var exitHooks struct {
+	sync.Mutex
+	fns []func()
+	// done is true once the hooks have been run.
+	done bool
+}
+
+// atExit registers fn to be run before the process terminates by a call to
+// exit, fatal or an interrupt signal.
+func atExit(fn func()) {
+	exitHooks.Lock()
+	defer exitHooks.Unlock()
+	exitHooks.fns = append(exitHooks.fns, fn)
+}
+
+// exit runs the registered exit hooks and terminates the process with the
+// provided status code.
+func exit(code int) {
+	exitHooks.Lock()
+	if !exitHooks.done {
+		exitHooks.done = true
+		for i := len(exitHooks.fns) - 1; i >= 0; i-- {
+			exitHooks.fns[i]()
+		}
+	}
+	exitHooks.Unlock()
+	os.Exit(code)
+}
+
+// fatal logs v and terminates the process with status code 1, after running
+// the registered exit hooks.
+func fatal(v ...interface{}) {
+	log.Println(v...)
+	exit(exitFailure)
+}
+
+// fatalError logs err and terminates the process with a status code which
+// distinguishes usage errors, timeouts and refused connections from other
+// errors, after
+// running the registered exit hooks.
+func fatalError(err error) {
+	log.Println(err)
+	exit(exitCode(err))
+}
+
+// A usageError is an error caused by invalid command line arguments.
+type usageError struct {
+	error
+}
+
+// usagef returns a usageError with the provided formatted message.
+func usagef(format string, v ...interface{}) error {
+	return usageError{fmt.Errorf(format, v...)}
+}
+
+// exitCode returns the status code used to report err.
+func exitCode(err error) int {
+	switch {
+	case errors.As(err, new(usageError)):
+		return exitUsage
+	case isTimeout(err):
+		return exitTimeout
+	case isRefused(err):
+		return exitRefused
+	}
+	return exitFailure
+}
+
+// handleSignals runs the registered exit hooks when the process is interrupted
+// or terminated by a signal.
+func handleSignals() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-c
+		code := 1
+		if s, ok := sig.(syscall.Signal); ok {
+			code = 128 + int(s)
+		}
+		exit(code)
+	}()
+}
@@ -1,11 +1,16 @@
 package main
 
+import "context"
+import "crypto/tls"
+import "errors"
 import "flag"
 import "fmt"
 import "io"
 import "log"
 import "net"
 import "os"
+import "sync"
+import "time"
 
 // flagProto specifies the protocol to be used for connections.
 var flagProto string
@@ -13,130 +18,679 @@ var flagProto string
 // When flagListen is true, listen for incoming connections.
 var flagListen bool
 
+// flagQuit is the number of seconds to wait after EOF on standard input before
+// quitting. A negative value waits until the peer closes the connection.
+var flagQuit int
+
+// When flagShutdown is true, shut down the writing side of network connections
+// after EOF on standard input.
+var flagShutdown bool
+
+// flagWait is the number of seconds after which connection attempts and idle
+// connections time out. No timeout is used if zero.
+var flagWait int
+
+// flagKeepAlive specifies the keep-alive period of TCP connections.
+var flagKeepAlive time.Duration
+
+// When flagZero is true, scan for open ports without sending any data.
+var flagZero bool
+
+// flagWorkers is the number of ports probed concurrently in zero-I/O mode.
+var flagWorkers int
+
+// When flagTLS is true, use TLS for connections.
+var flagTLS bool
+
+// flagSNI specifies the server name used to connect with TLS.
+var flagSNI string
+
+// flagCA specifies the path of a PEM file containing the certificate
+// authorities used to verify TLS peers.
+var flagCA string
+
+// When flagInsecure is true, skip the verification of TLS servers.
+var flagInsecure bool
+
+// flagCert and flagKey specify the paths of PEM files containing the TLS
+// certificate and private key of nc.
+var flagCert, flagKey string
+
+// When flagVerbose is true, output verbose information to standard error.
+var flagVerbose bool
+
+// flagExec specifies a program and its arguments, separated by spaces, to
+// execute per connection.
+var flagExec string
+
+// flagCmd specifies a shell command to execute per connection.
+var flagCmd string
+
+// When flagBroker is true, relay data between the clients of listen mode.
+var flagBroker bool
+
+// When flagBrokerPrefix is true, prefix each line of relayed data with the
+// address of its sender.
+var flagBrokerPrefix bool
+
+// When flagKeep is true, keep listening for new connections after the first
+// client has disconnected.
+var flagKeep bool
+
+// flagMaxClients is the maximum number of clients handled concurrently when
+// listening with the "-k" flag. No limit is used if zero.
+var flagMaxClients int
+
+// flagWriteTimeout is the duration after which clients of listen mode are
+// evicted if a write to them blocks. No timeout is used if zero.
+var flagWriteTimeout time.Duration
+
+// flagProxyTo specifies the upstream address to which connections are
+// forwarded in listen mode.
+var flagProxyTo string
+
+// When flagProxyDump is true, log forwarded traffic as hex dumps.
+var flagProxyDump bool
+
+// flagProxy specifies the address of the proxy used to connect.
+var flagProxy string
+
+// flagProxyProto specifies the protocol of the proxy used to connect; "5" for
+// SOCKS5 and "connect" for HTTP CONNECT.
+var flagProxyProto string
+
+// flagProxyAuth specifies the user name and password, separated by a colon,
+// used to authenticate with the proxy.
+var flagProxyAuth string
+
+// flagOutput specifies the path of a file to which traffic is logged as hex
+// dumps.
+var flagOutput string
+
+// flagSource and flagPort specify the local address and port of outgoing
+// connections.
+var flagSource string
+var flagPort int
+
+// When flagIPv4 or flagIPv6 is true, use only IPv4 or IPv6 respectively.
+var flagIPv4, flagIPv6 bool
+
+// flagRate is the maximum rate of data transfer in each direction, in bytes per
+// second. No limit is used if zero.
+var flagRate rate
+
+// When flagStats is true, output transfer statistics to standard error on exit.
+var flagStats bool
+
+// flagStatsInterval is the interval of transfer statistics output. Statistics
+// are only output on exit if zero.
+var flagStatsInterval time.Duration
+
+// flagUnix specifies the path of a Unix domain socket to be used instead of
+// ADDR.
+var flagUnix string
+
 func init() {
-	flag.StringVar(&flagProto, "proto", "tcp", "Transfer protocol.")
+	flag.StringVar(&flagProto, "proto", "tcp", "Transfer protocol (tcp, udp, ...).")
 	flag.BoolVar(&flagListen, "l", false, "Listen for incoming connections.")
+	flag.IntVar(&flagQuit, "q", -1, "Quit x seconds after EOF on standard input; wait for the peer to close if negative.")
+	flag.BoolVar(&flagShutdown, "N", false, "Shut down the writing side of the connection after EOF on standard input.")
+	flag.IntVar(&flagWait, "w", 0, "Time out connection attempts and connections idle for x seconds.")
+	flag.DurationVar(&flagKeepAlive, "keepalive", 0, "TCP keep-alive `PERIOD`; use the system default if zero, and disable keep-alives if negative.")
+	flag.BoolVar(&flagZero, "z", false, "Zero-I/O mode; report which of the specified ports are open.")
+	flag.IntVar(&flagWorkers, "workers", 16, "Number of ports probed concurrently in zero-I/O mode.")
+	flag.BoolVar(&flagTLS, "tls", false, "Use TLS for connections.")
+	flag.StringVar(&flagSNI, "tls-sni", "", "Server `NAME` used to connect with TLS (default host of ADDR).")
+	flag.StringVar(&flagCA, "tls-ca", "", "Verify TLS peers using the certificate authorities of the PEM `FILE`; require client certificates in listen mode.")
+	flag.BoolVar(&flagInsecure, "insecure", false, "Skip the verification of TLS servers.")
+	flag.StringVar(&flagCert, "tls-cert", "", "TLS certificate PEM `FILE`; a client certificate in connect mode (default self-signed in listen mode).")
+	flag.StringVar(&flagKey, "tls-key", "", "Private key PEM `FILE` of the TLS certificate.")
+	flag.BoolVar(&flagVerbose, "v", false, "Output verbose information to standard error.")
+	flag.StringVar(&flagExec, "e", "", "Execute `PROG` with its standard input and output connected to each connection; arguments are separated by spaces.")
+	flag.StringVar(&flagCmd, "c", "", "Execute the shell command `CMD` with its standard input and output connected to each connection.")
+	flag.BoolVar(&flagKeep, "k", false, "Keep listening for new connections after the first client disconnects.")
+	flag.IntVar(&flagMaxClients, "max-clients", 0, "Maximum number of concurrent clients with -k; further connections wait until a client disconnects (no limit if 0).")
+	flag.DurationVar(&flagWriteTimeout, "write-timeout", 10*time.Second, "Evict clients of listen mode when a write to them blocks for `DURATION` (no timeout if 0).")
+	flag.BoolVar(&flagBroker, "broker", false, "Relay data from each client to all other clients in listen mode; implies -k.")
+	flag.BoolVar(&flagBrokerPrefix, "broker-prefix", false, "Prefix each line of relayed data with the address of its sender.")
+	flag.StringVar(&flagProxyTo, "proxy-to", "", "Forward each connection of listen mode to the upstream `ADDR`; implies -k.")
+	flag.BoolVar(&flagProxyDump, "proxy-dump", false, "Log forwarded traffic as hex dumps to standard error.")
+	flag.StringVar(&flagProxy, "x", "", "Connect through the proxy at `ADDR`.")
+	flag.StringVar(&flagProxyProto, "X", "5", "Use the proxy protocol `PROTO`; 5 for SOCKS5 and connect for HTTP CONNECT.")
+	flag.StringVar(&flagProxyAuth, "proxy-auth", "", "Authenticate with the proxy using `USER:PASS`.")
+	flag.StringVar(&flagOutput, "o", "", "Log timestamped hex dumps of all sent and received data to `FILE`.")
+	flag.StringVar(&flagSource, "s", "", "Use the local source `ADDR` for outgoing connections.")
+	flag.IntVar(&flagPort, "p", 0, "Use the local source `PORT` for outgoing connections.")
+	flag.BoolVar(&flagIPv4, "4", false, "Use IPv4 only.")
+	flag.BoolVar(&flagIPv6, "6", false, "Use IPv6 only.")
+	flag.Var(&flagRate, "rate", "Limit the transfer `RATE` in each direction to bytes per second, with an optional K, M or G suffix (no limit if 0).")
+	flag.BoolVar(&flagStats, "stats", false, "Output transfer statistics to standard error on exit, and on SIGUSR1.")
+	flag.DurationVar(&flagStatsInterval, "stats-interval", 0, "Output transfer statistics every `INTERVAL` with -stats.")
+	flag.StringVar(&flagUnix, "U", "", "Use the Unix domain socket `PATH` instead of ADDR.")
 	flag.Usage = usage
 }
 
 func usage() {
 	fmt.Fprintln(os.Stderr, "Usage: nc [OPTION]... ADDR")
+	fmt.Fprintln(os.Stderr, "  or:  nc [OPTION]... -U PATH")
+	fmt.Fprintln(os.Stderr, "  or:  nc [OPTION]... -z HOST PORTS...")
 	fmt.Fprintln(os.Stderr, "Read and write data across networks.")
 	fmt.Fprintln(os.Stderr)
 	fmt.Fprintln(os.Stderr, "Flags:")
 	flag.PrintDefaults()
 	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Exit status:")
+	fmt.Fprintln(os.Stderr, "  0 on success, 2 on invalid arguments, 3 if the connection was refused, 4 if")
+	fmt.Fprintln(os.Stderr, "  the connection timed out, and 1 on other errors. In zero-I/O mode, 0 if any")
+	fmt.Fprintln(os.Stderr, "  port is open, and 1 otherwise. In listen mode without -k, 0 once the client")
+	fmt.Fprintln(os.Stderr, "  disconnects.")
+	fmt.Fprintln(os.Stderr)
 	fmt.Fprintln(os.Stderr, "Examples:")
 	fmt.Fprintln(os.Stderr, "  Connect to example.org on TCP port 8080.")
 	fmt.Fprintln(os.Stderr, "    nc example.org:8080")
-	fmt.Fprintln(os.Stderr, "  Listen for connections on TCP port 8080.")
+	fmt.Fprintln(os.Stderr, "  Listen for a connection on TCP port 8080, and exit once the client disconnects.")
 	fmt.Fprintln(os.Stderr, "    nc -l :8080")
+	fmt.Fprintln(os.Stderr, "  Listen for connections on TCP port 8080, serving at most 10 clients at once.")
+	fmt.Fprintln(os.Stderr, "    nc -l -k -max-clients 10 :8080")
 	fmt.Fprintln(os.Stderr, "  Listen for connections on localhost at TCP port 8080.")
 	fmt.Fprintln(os.Stderr, "    nc -l 127.0.0.1:8080")
+	fmt.Fprintln(os.Stderr, "  Listen for packets on UDP port 9000.")
+	fmt.Fprintln(os.Stderr, "    nc -proto udp -l :9000")
+	fmt.Fprintln(os.Stderr, "  Connect to example.org on TCP port 8080, giving up after 5 idle seconds.")
+	fmt.Fprintln(os.Stderr, "    nc -w 5 example.org:8080")
+	fmt.Fprintln(os.Stderr, "  Report which of the TCP ports 20 to 30 and 80 of example.org are open.")
+	fmt.Fprintln(os.Stderr, "    nc -z -w 1 example.org 20-30,80")
+	fmt.Fprintln(os.Stderr, "  Connect to example.org on port 443 using TLS, and output connection details.")
+	fmt.Fprintln(os.Stderr, "    nc -tls -v example.org:443")
+	fmt.Fprintln(os.Stderr, "  Listen for TLS connections on port 8443, using a self-signed certificate.")
+	fmt.Fprintln(os.Stderr, "    nc -tls -l :8443")
+	fmt.Fprintln(os.Stderr, "  Serve the current date to each client connecting to TCP port 8013.")
+	fmt.Fprintln(os.Stderr, "    nc -l -e date :8013")
+	fmt.Fprintln(os.Stderr, "  Relay messages between the clients connected to TCP port 9000.")
+	fmt.Fprintln(os.Stderr, "    nc -l -broker -broker-prefix :9000")
+	fmt.Fprintln(os.Stderr, "  Forward connections to TCP port 8080 to backend:80.")
+	fmt.Fprintln(os.Stderr, "    nc -l -proxy-to backend:80 :8080")
+	fmt.Fprintln(os.Stderr, "  Connect to example.org on TCP port 22 through the SOCKS5 proxy at proxy:1080.")
+	fmt.Fprintln(os.Stderr, "    nc -x proxy:1080 example.org:22")
+	fmt.Fprintln(os.Stderr, "  Connect to example.org on TCP port 443 through the HTTP proxy at proxy:3128.")
+	fmt.Fprintln(os.Stderr, "    nc -X connect -x proxy:3128 example.org:443")
+	fmt.Fprintln(os.Stderr, "  Connect to example.org on TCP port 25, and log the session to smtp.log.")
+	fmt.Fprintln(os.Stderr, "    nc -o smtp.log example.org:25")
+	fmt.Fprintln(os.Stderr, "  Connect to example.org on TCP port 80 over IPv6, from local port 4000.")
+	fmt.Fprintln(os.Stderr, "    nc -6 -p 4000 example.org:80")
+	fmt.Fprintln(os.Stderr, "  Send file.bin to example.org on TCP port 9000 at 10 MiB/s, with statistics.")
+	fmt.Fprintln(os.Stderr, "    nc -rate 10M -stats example.org:9000 < file.bin")
+	fmt.Fprintln(os.Stderr, "  Send an HTTP request to example.org, and output the response.")
+	fmt.Fprintln(os.Stderr, `    printf 'GET / HTTP/1.0\r\n\r\n' | nc example.org:80`)
+	fmt.Fprintln(os.Stderr, "  Connect to the Unix domain socket /run/foo.sock.")
+	fmt.Fprintln(os.Stderr, "    nc -U /run/foo.sock")
+	fmt.Fprintln(os.Stderr, "  Listen for datagrams on the Unix domain socket /tmp/nc.sock.")
+	fmt.Fprintln(os.Stderr, "    nc -proto unixgram -l /tmp/nc.sock")
 }
 
 func main() {
 	flag.Parse()
-	if flag.NArg() != 1 {
+	handleSignals()
+	if flagZero {
+		// scan
+		if flagListen || flagUnix != "" || flag.NArg() < 2 {
+			flag.Usage()
+			exit(exitUsage)
+		}
+		ports, err := checkScanFlags(flag.Args()[1:])
+		if err != nil {
+			fatalError(err)
+		}
+		open, err := scan(os.Stdout, flag.Arg(0), ports)
+		if err != nil {
+			fatal(err)
+		}
+		if !open {
+			exit(1)
+		}
+		exit(0)
+	}
+	var addr string
+	switch {
+	case flagUnix != "" && flag.NArg() == 0:
+		addr = flagUnix
+		switch flagProto {
+		case "tcp":
+			// Use stream sockets unless another Unix domain socket protocol has
+			// been specified.
+			flagProto = "unix"
+		case "unix", "unixgram", "unixpacket":
+		default:
+			fatalError(usagef("nc: -U is incompatible with -proto %s", flagProto))
+		}
+	case flagUnix == "" && flag.NArg() == 1:
+		addr = flag.Arg(0)
+	default:
 		flag.Usage()
-		os.Exit(1)
+		exit(exitUsage)
+	}
+	if err := checkFlags(); err != nil {
+		fatalError(err)
+	}
+	initStats()
+	if flagOutput != "" {
+		err := openCapture(flagOutput)
+		if err != nil {
+			fatal(err)
+		}
 	}
-	addr := flag.Arg(0)
 	if flagListen {
 		// listen
 		err := listen(addr)
 		if err != nil {
-			log.Fatalln(err)
+			fatal(err)
 		}
 	} else {
 		// connect
 		err := connect(addr)
 		if err != nil {
-			log.Fatalln(err)
+			fatalError(err)
+		}
+	}
+	exit(0)
+}
+
+// checkScanFlags checks the command line flags of scan mode, and returns the
+// ports to scan of specs.
+func checkScanFlags(specs []string) (ports []int, err error) {
+	if err := initAddrFlags(); err != nil {
+		return nil, usageError{err}
+	}
+	ports, err = parsePorts(specs)
+	if err != nil {
+		return nil, usageError{err}
+	}
+	return ports, nil
+}
+
+// checkFlags checks the command line flags of connect and listen mode, which
+// are mutually compatible once it returns without error.
+func checkFlags() error {
+	if err := initAddrFlags(); err != nil {
+		return usageError{err}
+	}
+	if flagTLS && isPacketProto(flagProto) {
+		return usagef("nc: -tls is incompatible with -proto %s", flagProto)
+	}
+	if flagBroker {
+		if !flagListen || hasCommand() || isPacketProto(flagProto) {
+			return usagef("nc: -broker requires stream listen mode without -e or -c")
+		}
+		flagKeep = true
+	}
+	if flagProxyTo != "" {
+		if !flagListen || flagBroker || hasCommand() || isPacketProto(flagProto) {
+			return usagef("nc: -proxy-to requires stream listen mode without -broker, -e or -c")
+		}
+		flagKeep = true
+	}
+	if flagProxy != "" {
+		switch {
+		case flagListen:
+			return usagef("nc: -x is incompatible with -l")
+		case flagProto != "tcp" && flagProto != "tcp4" && flagProto != "tcp6":
+			return usagef("nc: -x is incompatible with -proto %s", flagProto)
+		}
+		switch flagProxyProto {
+		case "5", "connect":
+		default:
+			return usagef("nc: invalid proxy protocol %s", flagProxyProto)
+		}
+	}
+	if flagMaxClients != 0 && (!flagKeep || flagMaxClients < 0) {
+		return usagef("nc: -max-clients requires -k and a positive number of clients")
+	}
+	if hasCommand() {
+		if isPacketProto(flagProto) {
+			return usagef("nc: -e and -c are incompatible with -proto %s", flagProto)
+		}
+		if _, err := command(); err != nil {
+			return usageError{err}
 		}
 	}
+	return nil
 }
 
 // listen listens for incoming connections and handles their input and output.
 func listen(addr string) (err error) {
-	l, err := net.Listen(flagProto, addr)
+	if isUnixProto(flagProto) {
+		// Remove stale socket file of a previous listener, and the socket file
+		// of this listener on exit.
+		err = removeStaleSocket(flagProto, addr)
+		if err != nil {
+			return err
+		}
+		atExit(func() {
+			os.Remove(addr)
+		})
+	}
+	if isPacketProto(flagProto) {
+		return listenPacket(addr)
+	}
+	var config *tls.Config
+	if flagTLS {
+		config, err = serverConfig(addr)
+		if err != nil {
+			return err
+		}
+	}
+	lc := net.ListenConfig{KeepAlive: flagKeepAlive}
+	l, err := lc.Listen(context.Background(), flagProto, addr)
 	if err != nil {
 		return err
 	}
+	return listenStream(l, config)
+}
+
+// listenStream accepts incoming connections from l, and handles their input
+// and output. TLS is used if config is non-nil.
+func listenStream(l net.Listener, config *tls.Config) error {
+	switch {
+	case hasCommand():
+		return accept(l, config, execClient)
+	case flagProxyTo != "":
+		return accept(l, config, proxyClient)
+	}
 	cl := NewConnList()
-	go listenInput(cl)
+	var once sync.Once
+	return accept(l, config, func(conn net.Conn) {
+		err := handshake(conn)
+		if err != nil {
+			log.Println(err)
+			conn.Close()
+			return
+		}
+		c := cl.Add(conn)
+		// Start reading standard input once the first client has connected,
+		// so that no input is lost.
+		once.Do(func() {
+			go listenInput(cl, os.Stdin)
+		})
+		listenOutput(c, cl)
+	})
+}
+
+// accept accepts incoming connections from l, and handles each connection by
+// invoking serve. TLS is used if config is non-nil.
+//
+// Unless the "-k" flag is set, only a single connection is accepted, and accept
+// returns once it has been handled. Otherwise, connections are accepted until
+// an error occurs, and at most as many connections as specified by the
+// "-max-clients" flag are handled concurrently; further connections wait to be
+// accepted until a client disconnects.
+func accept(l net.Listener, config *tls.Config, serve func(conn net.Conn)) error {
+	var slots chan bool
+	if flagMaxClients > 0 {
+		slots = make(chan bool, flagMaxClients)
+	}
 	for {
+		if slots != nil {
+			slots <- true
+		}
 		conn, err := l.Accept()
 		if err != nil {
 			return err
 		}
-		cl.Add(conn.RemoteAddr().String(), conn)
-		go listenOutput(conn, cl)
+		conn = serverConn(conn, config)
+		if !flagKeep {
+			// Stop listening, and return once the client has disconnected.
+			l.Close()
+			serve(conn)
+			return nil
+		}
+		go func() {
+			serve(conn)
+			if slots != nil {
+				<-slots
+			}
+		}()
 	}
 }
 
-// listenInput writes to all connected clients from standard input.
-func listenInput(cl *connList) {
-	buf := make([]byte, 32*1024)
+// serverConn returns the server side of the accepted connection conn, which
+// times out after being idle for the duration of the "-w" flag. TLS is used if
+// config is non-nil.
+func serverConn(conn net.Conn, config *tls.Config) net.Conn {
+	if timeout := waitTimeout(); timeout > 0 {
+		conn = newIdleConn(conn, timeout)
+	}
+	if config != nil {
+		conn = tls.Server(conn, config)
+	}
+	return conn
+}
+
+// handshake performs the TLS handshake of conn, if conn is a TLS connection.
+func handshake(conn net.Conn) error {
+	if tc, ok := conn.(*tls.Conn); ok {
+		return tlsHandshake(tc)
+	}
+	return nil
+}
+
+// execClient executes the command of the "-e" or "-c" flags, with its standard
+// input and output wired to the client connection conn.
+func execClient(conn net.Conn) {
+	err := handshake(conn)
+	if err != nil {
+		log.Println(err)
+		conn.Close()
+		return
+	}
+	err = execConn(conn)
+	if err != nil {
+		log.Printf("nc: %s: %v", conn.RemoteAddr(), err)
+	}
+}
+
+// listenPacket listens for incoming packets and writes their contents to
+// standard output. Peers are tracked by their source address, so that input
+// from standard input is sent to every peer which has sent a packet.
+func listenPacket(addr string) (err error) {
+	pc, err := net.ListenPacket(flagProto, addr)
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+	cl := NewConnList()
+	return servePacket(pc, cl, os.Stdin, os.Stdout)
+}
+
+// servePacket writes the contents of the packets received by pc to w, and adds
+// their peers to cl. Once the first peer is known, input read from stdin is
+// sent to all peers.
+func servePacket(pc net.PacketConn, cl *connList, stdin io.Reader, w io.Writer) error {
+	peers := make(map[string]*client)
+	var once sync.Once
+	buf := make([]byte, 64*1024)
 	for {
-		n, err := os.Stdin.Read(buf)
+		n, raddr, err := pc.ReadFrom(buf)
 		if err != nil {
-			if err == io.EOF {
-				// clean exit on EOF.
-				os.Exit(0)
+			return err
+		}
+		transfer.received.Add(int64(n))
+		if transfer.recvLimit != nil {
+			transfer.recvLimit.wait(n)
+		}
+		if raddr != nil {
+			// Track peer, to send it input from stdin.
+			c, ok := peers[raddr.String()]
+			if !ok || c.closed() {
+				c = cl.Add(&packetConn{PacketConn: pc, raddr: raddr})
+				peers[raddr.String()] = c
+				once.Do(func() { go listenInput(cl, stdin) })
+			}
+			if c.received != nil {
+				c.received.Write(buf[:n])
 			}
-			log.Fatalln(err)
 		}
-		for _, conn := range cl.Conns() {
-			// write input to all connected clients.
-			_, err := conn.Write(buf[:n])
-			if err != nil {
-				log.Println(err)
+		_, err = w.Write(buf[:n])
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// listenInput writes to all connected clients from standard input, which is
+// read from stdin.
+func listenInput(cl *connList, stdin io.Reader) {
+	r := sendReader(stdin)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			if err == io.EOF {
+				// keep handling client output after EOF. In broker mode,
+				// clients keep receiving relayed data.
+				if flagShutdown && !flagBroker {
+					cl.CloseWrite()
+				}
+				quitAfterEOF()
+				return
 			}
+			fatal(err)
 		}
+		// write input to all connected clients, at the pace of the fastest
+		// client.
+		cl.Broadcast(buf[:n], nil)
+		cl.WaitReady()
 	}
 }
 
-// listenOutput writes to standard output from conn. Client connections are
-// removed from the list once they disconnect.
-func listenOutput(conn net.Conn, cl *connList) {
-	_, err := io.Copy(os.Stdout, conn)
-	if err != nil {
+// listenOutput writes to standard output from c. In broker mode, the data is
+// also relayed to all other clients. Clients are closed and removed from the
+// list once they disconnect.
+func listenOutput(c *client, cl *connList) {
+	var w io.Writer = os.Stdout
+	if flagBroker {
+		w = io.MultiWriter(os.Stdout, newRelay(c, cl))
+	}
+	r := recvReader(c)
+	if c.received != nil {
+		r = io.TeeReader(r, c.received)
+	}
+	_, err := io.Copy(w, r)
+	if isTimeout(err) {
+		log.Printf("nc: connection from %s idle for %v", c.RemoteAddr(), waitTimeout())
+	} else if err != nil && !errors.Is(err, net.ErrClosed) {
 		log.Println(err)
 	}
 	// client has disconnected.
-	cl.Del(conn.RemoteAddr().String())
+	c.Close()
 }
 
 // connect connects to host:port and handles the connection's input and output.
+// Output from the connection is handled until the peer closes the connection,
+// also after standard input has reached EOF.
 func connect(addr string) (err error) {
-	conn, err := net.Dial(flagProto, addr)
+	conn, err := dial(addr)
 	if err != nil {
-		return err
+		return dialError(addr, err)
 	}
-	done := make(chan bool)
-	go connectInput(conn, done)
+	if hasCommand() {
+		return execConn(conn)
+	}
+	defer conn.Close()
+	eof := make(chan bool, 1)
+	done := make(chan error, 1)
+	go connectInput(conn, os.Stdin, eof)
 	go connectOutput(conn, done)
-	<-done
-	return nil
+	for {
+		select {
+		case <-eof:
+			quitAfterEOF()
+		case err := <-done:
+			// peer has closed the connection.
+			if isTimeout(err) {
+				return fmt.Errorf("nc: connection to %s idle for %v; %w", addr, waitTimeout(), err)
+			}
+			return err
+		}
+	}
+}
+
+// dial connects to the provided address using the protocol of the "-proto"
+// flag.
+func dial(addr string) (conn net.Conn, err error) {
+	if flagProto == "unixgram" {
+		return dialUnixgram(addr)
+	}
+	if flagProxy != "" {
+		conn, err = dialProxy(addr)
+	} else {
+		conn, err = newDialer().Dial(flagProto, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if timeout := waitTimeout(); timeout > 0 {
+		conn = newIdleConn(conn, timeout)
+	}
+	if flagTLS {
+		tc, err := tlsClient(conn, addr)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tc, nil
+	}
+	return conn, nil
 }
 
-// connectInput writes to conn from standard input. Once complete, it sends a
-// notification on the done channel.
-func connectInput(conn net.Conn, done chan bool) {
-	_, err := io.Copy(conn, os.Stdin)
+// connectInput writes to conn from standard input, which is read from stdin.
+// Once complete, it sends a notification on the eof channel.
+func connectInput(conn net.Conn, stdin io.Reader, eof chan bool) {
+	_, err := io.Copy(conn, captureReader(sendReader(stdin), ">", conn.RemoteAddr()))
 	if err != nil {
 		log.Println(err)
 	}
-	done <- true
+	inputDone(conn)
+	eof <- true
 }
 
-// connectOutput writes to standard output from conn. Once complete, it sends a
-// notification on the done channel.
-func connectOutput(conn net.Conn, done chan bool) {
-	_, err := io.Copy(os.Stdout, conn)
+// connectOutput writes to standard output from conn. Once complete, it sends
+// the error encountered, if any, on the done channel.
+func connectOutput(conn net.Conn, done chan error) {
+	_, err := io.Copy(os.Stdout, captureReader(recvReader(conn), "<", conn.RemoteAddr()))
+	done <- err
+}
+
+// inputDone shuts down the writing side of conn once standard input has reached
+// EOF if the "-N" flag is set, to notify the peer that no more data will be
+// sent.
+func inputDone(conn net.Conn) {
+	if !flagShutdown {
+		return
+	}
+	err := closeWrite(conn)
 	if err != nil {
 		log.Println(err)
 	}
-	done <- true
+}
+
+// closeWrite shuts down the writing side of conn, if supported by the
+// connection.
+func closeWrite(conn net.Conn) error {
+	if cw, ok := conn.(interface {
+		CloseWrite() error
+	}); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// quitAfterEOF terminates the process after the delay of the "-q" flag, once
+// standard input has reached EOF.
+func quitAfterEOF() {
+	if flagQuit < 0 {
+		return
+	}
+	time.AfterFunc(time.Duration(flagQuit)*time.Second, func() {
+		exit(0)
+	})
 }
@@ -0,0 +1,104 @@
+package main
+
+import "io"
+import "net"
+import "os"
+import "testing"
+import "time"
+
+// redirectStdio redirects standard input to a pipe which never reaches EOF
+// until the end of the test, and standard output to a file. It returns the
+// file, which holds the output once the functions using standard output have
+// returned.
+func redirectStdio(t *testing.T) (stdout *os.File) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err = os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin, prevStdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = pr, stdout
+	t.Cleanup(func() {
+		os.Stdin, os.Stdout = stdin, prevStdout
+		pw.Close()
+		stdout.Close()
+	})
+	return stdout
+}
+
+// checkOutput checks that the contents of stdout are want.
+func checkOutput(t *testing.T, stdout *os.File, want string) {
+	buf, err := os.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf); got != want {
+		t.Errorf("expected output %q, got %q", want, got)
+	}
+}
+
+func TestListenSingleClient(t *testing.T) {
+	stdout := redirectStdio(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- listenStream(l, nil)
+	}()
+
+	// The listener returns once the client has disconnected, while standard
+	// input is still open.
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(conn, "hi\n")
+	conn.Close()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("listen did not return after the client disconnected")
+	}
+	checkOutput(t, stdout, "hi\n")
+}
+
+func TestConnectPeerClose(t *testing.T) {
+	stdout := redirectStdio(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		io.WriteString(conn, "bye\n")
+		conn.Close()
+	}()
+
+	// connect returns once the peer has closed the connection, while standard
+	// input is still open.
+	done := make(chan error)
+	go func() {
+		done <- connect(l.Addr().String())
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("connect did not return after the peer closed the connection")
+	}
+	checkOutput(t, stdout, "bye\n")
+}
@@ -0,0 +1,44 @@
+package main
+
+import "errors"
+import "net"
+import "strings"
+
+// A packetConn is a connection to a single peer of a packet-oriented listener.
+// Writes are sent as packets to the peer. The underlying listener is shared by
+// all peers, and is therefore not closed by Close.
+type packetConn struct {
+	net.PacketConn
+	// Address of the peer.
+	raddr net.Addr
+}
+
+// Read is not supported by packet peers, as the packets of all peers are read
+// from the shared listener.
+func (c *packetConn) Read(b []byte) (n int, err error) {
+	return 0, errors.New("nc: read from packet peer")
+}
+
+// Write sends b as a packet to the peer.
+func (c *packetConn) Write(b []byte) (n int, err error) {
+	return c.WriteTo(b, c.raddr)
+}
+
+// RemoteAddr returns the address of the peer.
+func (c *packetConn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+// Close is a no-op, as the underlying listener is shared by all peers.
+func (c *packetConn) Close() error {
+	return nil
+}
+
+// isPacketProto reports whether proto is a packet-oriented protocol.
+func isPacketProto(proto string) bool {
+	switch proto {
+	case "udp", "udp4", "udp6", "unixgram":
+		return true
+	}
+	return strings.HasPrefix(proto, "ip:") || strings.HasPrefix(proto, "ip4:") || strings.HasPrefix(proto, "ip6:")
+}
@@ -0,0 +1,88 @@
+package main
+
+import "bytes"
+import "io"
+import "net"
+import "testing"
+import "time"
+
+func TestServePacket(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := NewConnList()
+	stdin, input := io.Pipe()
+	defer input.Close()
+	out := new(bytes.Buffer)
+	done := make(chan error)
+	go func() {
+		done <- servePacket(pc, cl, stdin, out)
+	}()
+
+	// Standard input is not read before the first peer is known.
+	written := make(chan bool)
+	go func() {
+		io.WriteString(input, "reply\n")
+		close(written)
+	}()
+	select {
+	case <-written:
+		t.Fatal("input read before the first peer is known")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Send a packet from each peer. The first peer receives the pending input.
+	var peers []net.Conn
+	for i, msg := range []string{"foo\n", "bar\n"} {
+		peer, err := net.Dial("udp", pc.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer peer.Close()
+		_, err = peer.Write([]byte(msg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		peers = append(peers, peer)
+		if i == 0 {
+			readReply(t, peer, "reply\n")
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(cl.Clients()) < len(peers) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d peers, got %d", len(peers), len(cl.Clients()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Input is sent to every peer.
+	io.WriteString(input, "again\n")
+	for _, peer := range peers {
+		readReply(t, peer, "again\n")
+	}
+
+	pc.Close()
+	<-done
+	if got, want := out.String(), "foo\nbar\n"; got != want {
+		t.Errorf("expected output %q, got %q", want, got)
+	}
+	for _, c := range cl.Clients() {
+		c.Close()
+	}
+}
+
+// readReply checks that the next packet received by peer is want.
+func readReply(t *testing.T, peer net.Conn, want string) {
+	t.Helper()
+	peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 64)
+	n, err := peer.Read(buf)
+	if err != nil {
+		t.Fatalf("%s: %v", peer.LocalAddr(), err)
+	}
+	if got := string(buf[:n]); got != want {
+		t.Errorf("%s: expected %q, got %q", peer.LocalAddr(), want, got)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package main
+
+// notifyProgress does nothing, as SIGUSR1 is not supported on this platform.
+func notifyProgress(fn func()) {
+}
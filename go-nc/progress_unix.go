@@ -0,0 +1,18 @@
+//go:build unix
+
+package main
+
+import "os"
+import "os/signal"
+import "syscall"
+
+// notifyProgress invokes fn whenever the process receives SIGUSR1.
+func notifyProgress(fn func()) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1)
+	go func() {
+		for range c {
+			fn()
+		}
+	}()
+}
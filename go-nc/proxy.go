@@ -0,0 +1,85 @@
+package main
+
+import "encoding/hex"
+import "errors"
+import "io"
+import "log"
+import "net"
+import "sync"
+import "time"
+
+// proxyClient forwards the client connection conn to the upstream address of
+// the "-proxy-to" flag, in both directions. Once one side has sent EOF, the
+// writing side of the other side is shut down; the connections are closed once
+// both directions are complete. Statistics of the connection are logged on
+// close.
+func proxyClient(conn net.Conn) {
+	defer conn.Close()
+	err := handshake(conn)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	upstream, err := newDialer().Dial(flagProto, flagProxyTo)
+	if err != nil {
+		log.Printf("nc: %s: %v", conn.RemoteAddr(), dialError(flagProxyTo, err))
+		return
+	}
+	defer upstream.Close()
+	if timeout := waitTimeout(); timeout > 0 {
+		upstream = newIdleConn(upstream, timeout)
+	}
+
+	start := time.Now()
+	var sent, received int64
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		sent = splice(upstream, conn, sendReader, &dumpLog{client: conn.RemoteAddr(), upstream: flagProxyTo, dir: ">"})
+	}()
+	go func() {
+		defer wg.Done()
+		received = splice(conn, upstream, recvReader, &dumpLog{client: conn.RemoteAddr(), upstream: flagProxyTo, dir: "<"})
+	}()
+	wg.Wait()
+	log.Printf("nc: %s <-> %s closed; %d bytes sent, %d bytes received in %v", conn.RemoteAddr(), flagProxyTo, sent, received, time.Since(start).Round(time.Millisecond))
+}
+
+// splice copies from src to dst until EOF on src, and then shuts down the
+// writing side of dst. The data read from src is passed through meter, which
+// counts and limits it as sent or received data. The traffic is logged to dump
+// if the "-proxy-dump" flag is set, and to the file of the "-o" flag as
+// received from src and sent to dst. It returns the number of bytes copied.
+func splice(dst, src net.Conn, meter func(io.Reader) io.Reader, dump *dumpLog) (n int64) {
+	r := captureReader(meter(src), "<", src.RemoteAddr())
+	if flagProxyDump {
+		r = io.TeeReader(r, dump)
+	}
+	n, err := io.Copy(captureWriter(dst, ">", dst.RemoteAddr()), r)
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Println(err)
+		// Abort both directions.
+		src.Close()
+		dst.Close()
+		return n
+	}
+	closeWrite(dst)
+	return n
+}
+
+// A dumpLog logs the data written to it as a hex dump.
+type dumpLog struct {
+	// Addresses of the client and the upstream.
+	client   net.Addr
+	upstream string
+	// Direction of the data; ">" for data sent upstream, and "<" for data
+	// received from upstream.
+	dir string
+}
+
+// Write logs p as a hex dump.
+func (l *dumpLog) Write(p []byte) (n int, err error) {
+	log.Printf("nc: %s %s %s (%d bytes)\n%s", l.client, l.dir, l.upstream, len(p), hex.Dump(p))
+	return len(p), nil
+}
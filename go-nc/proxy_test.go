@@ -0,0 +1,96 @@
+package main
+
+import "io"
+import "net"
+import "testing"
+import "time"
+
+func TestProxyClient(t *testing.T) {
+	// The upstream replies once the client has shut down its writing side.
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf, err := io.ReadAll(conn)
+				if err != nil {
+					return
+				}
+				conn.Write(append([]byte("reply:"), buf...))
+			}()
+		}
+	}()
+	defer func(addr string) { flagProxyTo = addr }(flagProxyTo)
+	flagProxyTo = upstream.Addr().String()
+
+	front, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer front.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := front.Accept()
+		if err != nil {
+			return
+		}
+		proxyClient(conn)
+	}()
+
+	conn, err := net.Dial("tcp", front.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.WriteString(conn, "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.(*net.TCPConn).CloseWrite()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(buf), "reply:hello"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("proxied connection not closed once both directions are complete")
+	}
+}
+
+func TestProxyClientRefused(t *testing.T) {
+	// Find a port with no listener.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(addr string) { flagProxyTo = addr }(flagProxyTo)
+	flagProxyTo = l.Addr().String()
+	l.Close()
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	go proxyClient(conn)
+	// The client connection is closed once the upstream refuses.
+	peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = peer.Read(make([]byte, 1))
+	if err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
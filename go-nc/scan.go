@@ -0,0 +1,105 @@
+package main
+
+import "bufio"
+import "fmt"
+import "io"
+import "net"
+import "strconv"
+import "strings"
+import "sync"
+
+// scan probes the provided ports of host for open TCP ports, without sending
+// any data, and writes the state of each port to w. A line of the form
+// "HOST<TAB>PORT<TAB>STATE" is output per port, in the order the ports were
+// specified, where STATE is either "open" or "closed". Ports which time out are
+// considered closed. The returned open value is true if any port is open.
+func scan(w io.Writer, host string, ports []int) (open bool, err error) {
+	switch flagProto {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return false, fmt.Errorf("nc: -z is not supported with -proto %s", flagProto)
+	}
+	workers := flagWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	states := make([]bool, len(ports))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				states[i] = probe(host, ports[i])
+			}
+		}()
+	}
+	for i := range ports {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	bw := bufio.NewWriter(w)
+	for i, port := range ports {
+		state := "closed"
+		if states[i] {
+			state = "open"
+			open = true
+		}
+		fmt.Fprintf(bw, "%s\t%d\t%s\n", host, port, state)
+	}
+	return open, bw.Flush()
+}
+
+// probe reports whether a connection to the provided port of host succeeds
+// within the timeout of the "-w" flag, from the source address of the "-s"
+// flag.
+func probe(host string, port int) bool {
+	d := newDialer()
+	d.KeepAlive = -1
+	conn, err := d.Dial(flagProto, net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// parsePorts parses the provided port specifications, each of which is a
+// comma-separated list of ports and port ranges (e.g. "20-30,80,443").
+func parsePorts(specs []string) (ports []int, err error) {
+	for _, spec := range specs {
+		for _, s := range strings.Split(spec, ",") {
+			lo, hi := s, s
+			if pos := strings.IndexByte(s, '-'); pos != -1 {
+				lo, hi = s[:pos], s[pos+1:]
+			}
+			first, err := parsePort(lo)
+			if err != nil {
+				return nil, err
+			}
+			last, err := parsePort(hi)
+			if err != nil {
+				return nil, err
+			}
+			if first > last {
+				return nil, fmt.Errorf("nc: invalid port range %q", s)
+			}
+			for port := first; port <= last; port++ {
+				ports = append(ports, port)
+			}
+		}
+	}
+	return ports, nil
+}
+
+// parsePort parses the provided port number.
+func parsePort(s string) (port int, err error) {
+	port, err = strconv.Atoi(s)
+	if err != nil || port < 0 || port > 65535 {
+		return 0, fmt.Errorf("nc: invalid port %q", s)
+	}
+	return port, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import "fmt"
+import "net"
+import "reflect"
+import "strings"
+import "testing"
+
+func TestParsePorts(t *testing.T) {
+	golden := []struct {
+		specs []string
+		want  []int
+		err   bool
+	}{
+		{specs: []string{"80"}, want: []int{80}},
+		{specs: []string{"20-23,80", "443"}, want: []int{20, 21, 22, 23, 80, 443}},
+		{specs: []string{"0-1,65535"}, want: []int{0, 1, 65535}},
+		{specs: []string{"7-7"}, want: []int{7}},
+		{specs: []string{"30-20"}, err: true},
+		{specs: []string{"65536"}, err: true},
+		{specs: []string{"-1"}, err: true},
+		{specs: []string{"http"}, err: true},
+		{specs: []string{"80,"}, err: true},
+		{specs: []string{"1-2-3"}, err: true},
+	}
+	for _, g := range golden {
+		got, err := parsePorts(g.specs)
+		if g.err {
+			if err == nil {
+				t.Errorf("parsePorts(%q): expected error, got %v", g.specs, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePorts(%q): unexpected error; %v", g.specs, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, g.want) {
+			t.Errorf("parsePorts(%q): expected %v, got %v", g.specs, g.want, got)
+		}
+	}
+}
+
+// loopbackPort returns the port of a TCP listener on the loopback interface.
+// If closed is true, the listener is closed, so that the port is closed.
+func loopbackPort(t *testing.T, closed bool) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if closed {
+		l.Close()
+	} else {
+		t.Cleanup(func() { l.Close() })
+	}
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestScan(t *testing.T) {
+	defer func(wait, workers int) { flagWait, flagWorkers = wait, workers }(flagWait, flagWorkers)
+	flagWait = 1
+	flagWorkers = 2
+
+	open1, closed1, open2, closed2 := loopbackPort(t, false), loopbackPort(t, true), loopbackPort(t, false), loopbackPort(t, true)
+	ports := []int{open1, closed1, open2, closed2}
+	buf := new(strings.Builder)
+	open, err := scan(buf, "127.0.0.1", ports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !open {
+		t.Error("expected open ports")
+	}
+	want := fmt.Sprintf("127.0.0.1\t%d\topen\n127.0.0.1\t%d\tclosed\n127.0.0.1\t%d\topen\n127.0.0.1\t%d\tclosed\n", open1, closed1, open2, closed2)
+	if got := buf.String(); got != want {
+		t.Errorf("expected output %q, got %q", want, got)
+	}
+
+	buf.Reset()
+	open, err = scan(buf, "127.0.0.1", []int{closed1, closed2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if open {
+		t.Errorf("expected no open ports, got %q", buf.String())
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import "fmt"
+import "io"
+import "log"
+import "strconv"
+import "strings"
+import "sync"
+import "sync/atomic"
+import "time"
+
+// rateUnits maps from the unit suffixes of rates to their multiplier.
+var rateUnits = map[byte]int64{
+	'k': 1 << 10,
+	'K': 1 << 10,
+	'm': 1 << 20,
+	'M': 1 << 20,
+	'g': 1 << 30,
+	'G': 1 << 30,
+}
+
+// A rate is a number of bytes per second, which may be specified with a K, M
+// or G unit suffix for KiB, MiB and GiB per second (e.g. "10M").
+type rate int64
+
+// String returns the string representation of the rate.
+func (r *rate) String() string {
+	return strconv.FormatInt(int64(*r), 10)
+}
+
+// Set parses the rate of s.
+func (r *rate) Set(s string) error {
+	mul := int64(1)
+	if len(s) > 0 {
+		if m, ok := rateUnits[s[len(s)-1]]; ok {
+			mul = m
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid rate %q", s)
+	}
+	*r = rate(n * mul)
+	return nil
+}
+
+// A limiter limits the throughput of data using a token bucket.
+type limiter struct {
+	sync.Mutex
+	// Rate in bytes per second, and maximum number of tokens in the bucket.
+	rate, burst float64
+	// Number of tokens in the bucket, at the time of the last update.
+	tokens float64
+	last   time.Time
+}
+
+// newLimiter returns a new limiter of the provided rate, or nil if the rate
+// is unlimited.
+func newLimiter(r rate) *limiter {
+	if r <= 0 {
+		return nil
+	}
+	burst := float64(r) / 10
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{rate: float64(r), burst: burst, tokens: burst, last: time.Now()}
+}
+
+// wait takes n tokens from the bucket, and sleeps until the tokens have been
+// refilled if the bucket does not hold enough tokens.
+func (l *limiter) wait(n int) {
+	l.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var d time.Duration
+	if l.tokens < 0 {
+		d = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.Unlock()
+	time.Sleep(d)
+}
+
+// transfer holds the statistics and rate limits of the transferred data.
+var transfer struct {
+	// Start time of the transfer.
+	start time.Time
+	// Number of bytes sent and received.
+	sent, received atomic.Int64
+	// Rate limiters of sent and received data; or nil if unlimited.
+	sendLimit, recvLimit *limiter
+}
+
+// initStats starts measuring the transferred data, and limits its throughput
+// to the rate of the "-rate" flag in each direction. If the "-stats" flag is
+// set, the statistics of the transfer are logged on exit and periodically at
+// the interval of the "-stats-interval" flag, and when the process receives
+// SIGUSR1.
+func initStats() {
+	transfer.start = time.Now()
+	transfer.sendLimit = newLimiter(flagRate)
+	transfer.recvLimit = newLimiter(flagRate)
+	if !flagStats {
+		return
+	}
+	atExit(logStats)
+	notifyProgress(logStats)
+	if flagStatsInterval > 0 {
+		go func() {
+			for range time.Tick(flagStatsInterval) {
+				logStats()
+			}
+		}()
+	}
+}
+
+// logStats logs the number of bytes sent and received, the duration of the
+// transfer and the average rate in each direction.
+func logStats() {
+	d := time.Since(transfer.start)
+	sent, received := transfer.sent.Load(), transfer.received.Load()
+	log.Printf("nc: %d bytes sent (%s), %d bytes received (%s) in %v", sent, avgRate(sent, d), received, avgRate(received, d), d.Round(time.Millisecond))
+}
+
+// avgRate returns the average rate of n bytes transferred in duration d.
+func avgRate(n int64, d time.Duration) string {
+	r := float64(n) / d.Seconds()
+	units := []string{"B/s", "KiB/s", "MiB/s", "GiB/s"}
+	i := 0
+	for ; r >= 1024 && i < len(units)-1; i++ {
+		r /= 1024
+	}
+	return strings.TrimSuffix(strconv.FormatFloat(r, 'f', 1, 64), ".0") + " " + units[i]
+}
+
+// A meteredReader counts the bytes read from an underlying reader, and limits
+// the rate at which they are read.
+type meteredReader struct {
+	r io.Reader
+	// Byte counter.
+	n *atomic.Int64
+	// Rate limiter; or nil if unlimited.
+	lim *limiter
+}
+
+// sendReader returns a reader of r which counts the bytes read as sent data.
+func sendReader(r io.Reader) io.Reader {
+	return &meteredReader{r: r, n: &transfer.sent, lim: transfer.sendLimit}
+}
+
+// recvReader returns a reader of r which counts the bytes read as received
+// data.
+func recvReader(r io.Reader) io.Reader {
+	return &meteredReader{r: r, n: &transfer.received, lim: transfer.recvLimit}
+}
+
+// Read reads data from the underlying reader.
+func (mr *meteredReader) Read(p []byte) (n int, err error) {
+	if mr.lim != nil && len(p) > int(mr.lim.burst) {
+		// Keep reads within the burst size, for a steady rate.
+		p = p[:int(mr.lim.burst)]
+	}
+	n, err = mr.r.Read(p)
+	mr.n.Add(int64(n))
+	if mr.lim != nil && n > 0 {
+		mr.lim.wait(n)
+	}
+	return n, err
+}
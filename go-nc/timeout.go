@@ -0,0 +1,136 @@
+package main
+
+import "errors"
+import "fmt"
+import "net"
+import "os"
+import "sync"
+import "syscall"
+import "time"
+
+// An idleConn is a network connection which times out once no data has been
+// read from or written to it for the duration of its timeout.
+type idleConn struct {
+	net.Conn
+	// Idle timeout of the connection.
+	timeout time.Duration
+	// Time of the last activity on the connection, and write deadline set by
+	// the user of the connection, such as the write timeout of clients.
+	mu       sync.Mutex
+	last     time.Time
+	deadline time.Time
+}
+
+// newIdleConn returns a new connection which wraps conn and times out after
+// being idle for the provided duration.
+func newIdleConn(conn net.Conn, timeout time.Duration) *idleConn {
+	return &idleConn{Conn: conn, timeout: timeout, last: time.Now()}
+}
+
+// Read reads data from the connection. It fails with a timeout error if the
+// connection has been idle for the duration of its timeout.
+func (c *idleConn) Read(p []byte) (n int, err error) {
+	for {
+		// Writes extend the deadline of pending reads, as they are activity on
+		// the connection.
+		err = c.Conn.SetReadDeadline(c.lastActive().Add(c.timeout))
+		if err != nil {
+			return 0, err
+		}
+		n, err = c.Conn.Read(p)
+		if n > 0 || !errors.Is(err, os.ErrDeadlineExceeded) || time.Since(c.lastActive()) >= c.timeout {
+			c.touch()
+			return n, err
+		}
+	}
+}
+
+// Write writes data to the connection. It fails with a timeout error if the
+// write blocks for the duration of the timeout of the connection, or past the
+// write deadline of the connection, whichever comes first.
+func (c *idleConn) Write(p []byte) (n int, err error) {
+	deadline := time.Now().Add(c.timeout)
+	c.mu.Lock()
+	if !c.deadline.IsZero() && c.deadline.Before(deadline) {
+		deadline = c.deadline
+	}
+	c.mu.Unlock()
+	err = c.Conn.SetWriteDeadline(deadline)
+	if err != nil {
+		return 0, err
+	}
+	n, err = c.Conn.Write(p)
+	c.touch()
+	return n, err
+}
+
+// SetDeadline sets the write deadline of the connection; read deadlines are
+// governed by the idle timeout.
+func (c *idleConn) SetDeadline(t time.Time) error {
+	return c.SetWriteDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline of the connection, which applies
+// in addition to the idle timeout.
+func (c *idleConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+// CloseWrite shuts down the writing side of the connection, if supported by
+// the underlying connection.
+func (c *idleConn) CloseWrite() error {
+	return closeWrite(c.Conn)
+}
+
+// touch records activity on the connection.
+func (c *idleConn) touch() {
+	c.mu.Lock()
+	c.last = time.Now()
+	c.mu.Unlock()
+}
+
+// lastActive returns the time of the last activity on the connection.
+func (c *idleConn) lastActive() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+// isTimeout reports whether err is caused by a timeout.
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// isRefused reports whether err is caused by a refused connection.
+func isRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// dialError returns a descriptive error for the failed connection to addr.
+func dialError(addr string, err error) error {
+	var oe *net.OpError
+	if !errors.As(err, &oe) {
+		// Errors of proxies are already descriptive.
+		return err
+	}
+	switch {
+	case isTimeout(err):
+		return fmt.Errorf("nc: connection to %s timed out after %v; %w", addr, waitTimeout(), err)
+	case isRefused(err):
+		return fmt.Errorf("nc: connection to %s refused; %w", addr, err)
+	}
+	return err
+}
+
+// waitTimeout returns the connect and idle timeout specified by the "-w" flag,
+// or zero if no timeout is used.
+func waitTimeout() time.Duration {
+	if flagWait <= 0 {
+		return 0
+	}
+	return time.Duration(flagWait) * time.Second
+}
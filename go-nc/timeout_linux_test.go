@@ -0,0 +1,85 @@
+package main
+
+import "net"
+import "strings"
+import "syscall"
+import "testing"
+import "time"
+
+// listenFull returns the address of a TCP listener which never accepts, and
+// whose backlog is full, so that further connection attempts time out.
+func listenFull(t *testing.T) string {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { syscall.Close(fd) })
+	err = syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = syscall.Listen(fd, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sa, err := syscall.Getsockname(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := (&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: sa.(*syscall.SockaddrInet4).Port}).String()
+
+	// Fill the backlog.
+	for i := 0; ; i++ {
+		if i == 16 {
+			t.Skip("backlog of listener never full")
+		}
+		conn, err := net.DialTimeout("tcp", addr, 200*time.Millisecond)
+		if err != nil {
+			break
+		}
+		t.Cleanup(func() { conn.Close() })
+	}
+	return addr
+}
+
+func TestConnectTimeout(t *testing.T) {
+	addr := listenFull(t)
+	defer func(wait int) { flagWait = wait }(flagWait)
+	flagWait = 1
+
+	start := time.Now()
+	_, err := newDialer().Dial("tcp", addr)
+	if err == nil {
+		t.Fatalf("connection to %s did not time out", addr)
+	}
+	if d := time.Since(start); d < waitTimeout() {
+		t.Errorf("expected timeout after at least %v, got %v", waitTimeout(), d)
+	}
+	err = dialError(addr, err)
+	if !strings.Contains(err.Error(), "timed out after 1s") {
+		t.Errorf("expected timed out connection error, got %q", err)
+	}
+	if code := exitCode(err); code != exitTimeout {
+		t.Errorf("expected exit code %d, got %d", exitTimeout, code)
+	}
+}
+
+func TestScanTimeout(t *testing.T) {
+	addr := listenFull(t)
+	defer func(wait int) { flagWait = wait }(flagWait)
+	flagWait = 1
+
+	_, port, _ := net.SplitHostPort(addr)
+	p, err := parsePort(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(strings.Builder)
+	open, err := scan(buf, "127.0.0.1", []int{p})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "127.0.0.1\t" + port + "\tclosed\n"; open || buf.String() != want {
+		t.Errorf("expected output %q, got %q", want, buf.String())
+	}
+}
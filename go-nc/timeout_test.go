@@ -0,0 +1,131 @@
+package main
+
+import "errors"
+import "net"
+import "strings"
+import "testing"
+import "time"
+
+func TestIdleTimeout(t *testing.T) {
+	// The listener never accepts, so that the connection is established but
+	// no data is ever sent.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	const timeout = 200 * time.Millisecond
+	c := newIdleConn(conn, timeout)
+	defer c.Close()
+
+	// Writes are activity on the connection, which extends the deadline of
+	// reads.
+	go func() {
+		time.Sleep(timeout / 2)
+		c.Write([]byte("ping"))
+	}()
+	start := time.Now()
+	_, err = c.Read(make([]byte, 1))
+	if !isTimeout(err) {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	if d := time.Since(start); d < timeout*3/2 {
+		t.Errorf("expected timeout after at least %v, got %v", timeout*3/2, d)
+	}
+	if code := exitCode(err); code != exitTimeout {
+		t.Errorf("expected exit code %d, got %d", exitTimeout, code)
+	}
+}
+
+func TestIdleWriteDeadline(t *testing.T) {
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	c := newIdleConn(conn, time.Minute)
+	defer c.Close()
+
+	// The write deadline set by the user of the connection, such as the write
+	// timeout of clients, applies before the idle timeout.
+	const timeout = 100 * time.Millisecond
+	c.SetWriteDeadline(time.Now().Add(timeout))
+	done := make(chan error)
+	go func() {
+		_, err := c.Write([]byte("ping"))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !isTimeout(err) {
+			t.Errorf("expected timeout error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("write deadline overridden by the idle timeout")
+	}
+}
+
+func TestRefused(t *testing.T) {
+	// Find a port with no listener.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	_, err = newDialer().Dial("tcp", addr)
+	if err == nil {
+		t.Fatalf("connection to %s not refused", addr)
+	}
+	err = dialError(addr, err)
+	if !strings.Contains(err.Error(), "refused") {
+		t.Errorf("expected refused connection error, got %q", err)
+	}
+	if code := exitCode(err); code != exitRefused {
+		t.Errorf("expected exit code %d, got %d", exitRefused, code)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	if code := exitCode(errors.New("nc: failure")); code != exitFailure {
+		t.Errorf("expected exit code %d, got %d", exitFailure, code)
+	}
+}
+
+func TestUsageExitCode(t *testing.T) {
+	defer func(ipv4, ipv6, keep bool, maxClients int, proto, proxy, proxyProto string) {
+		flagIPv4, flagIPv6, flagKeep, flagMaxClients = ipv4, ipv6, keep, maxClients
+		flagProto, flagProxy, flagProxyProto = proto, proxy, proxyProto
+	}(flagIPv4, flagIPv6, flagKeep, flagMaxClients, flagProto, flagProxy, flagProxyProto)
+
+	golden := []struct {
+		name string
+		set  func()
+	}{
+		{name: "-4 -6", set: func() { flagIPv4, flagIPv6 = true, true }},
+		{name: "-max-clients without -k", set: func() { flagMaxClients = 3 }},
+		{name: "-X socks4", set: func() { flagProxy, flagProxyProto = "127.0.0.1:1080", "socks4" }},
+	}
+	for _, g := range golden {
+		flagIPv4, flagIPv6, flagKeep, flagMaxClients = false, false, false, 0
+		flagProto, flagProxy, flagProxyProto = "tcp", "", "5"
+		g.set()
+		err := checkFlags()
+		if err == nil {
+			t.Errorf("%s: expected error, got nil", g.name)
+			continue
+		}
+		if code := exitCode(err); code != exitUsage {
+			t.Errorf("%s: expected exit code %d, got %d", g.name, exitUsage, code)
+		}
+	}
+
+	// Invalid ports of scan mode.
+	flagIPv4, flagIPv6, flagProto = false, false, "tcp"
+	_, err := checkScanFlags([]string{"80-x"})
+	if code := exitCode(err); code != exitUsage {
+		t.Errorf("invalid port: expected exit code %d, got %d", exitUsage, code)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import "context"
+import "crypto/ecdsa"
+import "crypto/elliptic"
+import "crypto/rand"
+import "crypto/sha256"
+import "crypto/tls"
+import "crypto/x509"
+import "crypto/x509/pkix"
+import "errors"
+import "fmt"
+import "log"
+import "math/big"
+import "net"
+import "os"
+import "time"
+
+// tlsClient performs a TLS handshake as the client of conn, which is connected
+// to addr, and returns the resulting TLS connection.
+func tlsClient(conn net.Conn, addr string) (tc *tls.Conn, err error) {
+	config, err := clientConfig(addr)
+	if err != nil {
+		return nil, err
+	}
+	tc = tls.Client(conn, config)
+	err = tlsHandshake(tc)
+	if err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
+
+// clientConfig returns the TLS configuration used to connect to addr.
+func clientConfig(addr string) (config *tls.Config, err error) {
+	config = &tls.Config{
+		ServerName:         flagSNI,
+		InsecureSkipVerify: flagInsecure,
+	}
+	if config.ServerName == "" {
+		// Use the host of addr for server name indication.
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			config.ServerName = host
+		}
+	}
+	if flagCA != "" {
+		config.RootCAs, err = loadCAs()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if flagCert != "" || flagKey != "" {
+		// Authenticate using a client certificate.
+		cert, err := loadCert()
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// serverConfig returns the TLS configuration used to listen on addr. A
+// self-signed certificate is generated, unless a certificate is specified by
+// the "-tls-cert" and "-tls-key" flags. Client certificates are required if
+// certificate authorities are specified by the "-tls-ca" flag.
+func serverConfig(addr string) (config *tls.Config, err error) {
+	var cert tls.Certificate
+	if flagCert != "" || flagKey != "" {
+		cert, err = loadCert()
+	} else {
+		cert, err = selfSignedCert(addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	config = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+	if flagCA != "" {
+		// Require client certificates signed by the certificate authorities.
+		config.ClientCAs, err = loadCAs()
+		if err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// loadCAs loads the certificate authorities specified by the "-tls-ca" flag.
+func loadCAs() (pool *x509.CertPool, err error) {
+	buf, err := os.ReadFile(flagCA)
+	if err != nil {
+		return nil, err
+	}
+	pool = x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(buf) {
+		return nil, fmt.Errorf("nc: no certificates found in %q", flagCA)
+	}
+	return pool, nil
+}
+
+// loadCert loads the certificate and private key specified by the "-tls-cert"
+// and "-tls-key" flags.
+func loadCert() (cert tls.Certificate, err error) {
+	if flagCert == "" || flagKey == "" {
+		return tls.Certificate{}, errors.New("nc: -tls-cert and -tls-key must be used together")
+	}
+	return tls.LoadX509KeyPair(flagCert, flagKey)
+}
+
+// selfSignedCert generates a self-signed certificate, which is valid for
+// localhost and the host of addr.
+func selfSignedCert(addr string) (cert tls.Certificate, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "nc"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil && host != "" {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if flagVerbose {
+		log.Printf("nc: generated self-signed certificate; SHA-256 fingerprint %X", sha256.Sum256(der))
+	}
+	cert = tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}
+	return cert, nil
+}
+
+// tlsHandshake performs the TLS handshake of tc within the timeout of the "-w"
+// flag, and logs the details of the connection if the "-v" flag is set.
+func tlsHandshake(tc *tls.Conn) (err error) {
+	ctx := context.Background()
+	if timeout := waitTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	err = tc.HandshakeContext(ctx)
+	if err != nil {
+		return err
+	}
+	if flagVerbose {
+		logConnState(tc.RemoteAddr(), tc.ConnectionState())
+	}
+	return nil
+}
+
+// logConnState logs the negotiated version and cipher suite of the TLS
+// connection to the peer at addr, and the certificate chain of the peer.
+func logConnState(addr net.Addr, state tls.ConnectionState) {
+	log.Printf("nc: %s: %s, %s", addr, tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite))
+	for i, cert := range state.PeerCertificates {
+		log.Printf("nc: %s: certificate %d: subject %q, issuer %q, valid until %s", addr, i, cert.Subject, cert.Issuer, cert.NotAfter.Format(time.RFC3339))
+	}
+}
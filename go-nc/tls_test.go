@@ -0,0 +1,163 @@
+package main
+
+import "crypto/ecdsa"
+import "crypto/elliptic"
+import "crypto/rand"
+import "crypto/tls"
+import "crypto/x509"
+import "crypto/x509/pkix"
+import "encoding/pem"
+import "io"
+import "math/big"
+import "net"
+import "os"
+import "path/filepath"
+import "testing"
+import "time"
+
+// writeCert writes a self-signed certificate for 127.0.0.1, which is valid
+// for both server and client authentication, to PEM files in dir. It returns
+// the paths of the certificate and private key files.
+func writeCert(t *testing.T, dir, name string) (certPath, keyPath string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath = filepath.Join(dir, name+".pem")
+	keyPath = filepath.Join(dir, name+".key")
+	err = os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
+
+// tlsFlags holds the values of the TLS flags.
+type tlsFlags struct {
+	cert, key, ca string
+	insecure      bool
+}
+
+// set sets the TLS flags, and returns a function which restores their previous
+// values.
+func (f tlsFlags) set() (restore func()) {
+	prev := tlsFlags{cert: flagCert, key: flagKey, ca: flagCA, insecure: flagInsecure}
+	flagCert, flagKey, flagCA, flagInsecure = f.cert, f.key, f.ca, f.insecure
+	return func() {
+		flagCert, flagKey, flagCA, flagInsecure = prev.cert, prev.key, prev.ca, prev.insecure
+	}
+}
+
+// tlsExchange performs a TLS handshake over loopback between a server using the
+// TLS flags of server and a client using the TLS flags of client. On success,
+// the server sends a greeting to the client. It returns the errors of the
+// client and server.
+func tlsExchange(t *testing.T, server, client tlsFlags) (clientErr, serverErr error) {
+	restore := server.set()
+	config, err := serverConfig("127.0.0.1:0")
+	restore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	done := make(chan error)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			done <- err
+			return
+		}
+		defer conn.Close()
+		err = handshake(conn)
+		if err == nil {
+			_, err = io.WriteString(conn, "hello")
+		}
+		done <- err
+	}()
+
+	defer client.set()()
+	addr := l.Addr().String()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	tc, clientErr := tlsClient(conn, addr)
+	if clientErr == nil {
+		var buf []byte
+		buf, clientErr = io.ReadAll(io.LimitReader(tc, 5))
+		if clientErr == nil && string(buf) != "hello" {
+			t.Errorf("expected %q, got %q", "hello", buf)
+		}
+	} else {
+		conn.Close()
+	}
+	return clientErr, <-done
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	serverCert, serverKey := writeCert(t, dir, "server")
+	clientCert, clientKey := writeCert(t, dir, "client")
+	otherCert, _ := writeCert(t, dir, "other")
+
+	golden := []struct {
+		name           string
+		server, client tlsFlags
+		ok             bool
+	}{
+		{name: "self-signed insecure", client: tlsFlags{insecure: true}, ok: true},
+		{name: "self-signed unverified", client: tlsFlags{}},
+		{name: "trusted CA", server: tlsFlags{cert: serverCert, key: serverKey}, client: tlsFlags{ca: serverCert}, ok: true},
+		{name: "untrusted CA", server: tlsFlags{cert: serverCert, key: serverKey}, client: tlsFlags{ca: otherCert}},
+		{name: "client certificate", server: tlsFlags{cert: serverCert, key: serverKey, ca: clientCert}, client: tlsFlags{cert: clientCert, key: clientKey, ca: serverCert}, ok: true},
+		{name: "missing client certificate", server: tlsFlags{cert: serverCert, key: serverKey, ca: clientCert}, client: tlsFlags{ca: serverCert}},
+		{name: "untrusted client certificate", server: tlsFlags{cert: serverCert, key: serverKey, ca: otherCert}, client: tlsFlags{cert: clientCert, key: clientKey, ca: serverCert}},
+	}
+	for _, g := range golden {
+		clientErr, serverErr := tlsExchange(t, g.server, g.client)
+		switch {
+		case g.ok && (clientErr != nil || serverErr != nil):
+			t.Errorf("%s: unexpected error; client: %v, server: %v", g.name, clientErr, serverErr)
+		case !g.ok && clientErr == nil && serverErr == nil:
+			t.Errorf("%s: expected handshake failure", g.name)
+		}
+	}
+}
+
+func TestLoadCert(t *testing.T) {
+	dir := t.TempDir()
+	cert, _ := writeCert(t, dir, "server")
+	defer tlsFlags{cert: cert}.set()()
+	_, err := loadCert()
+	if err == nil {
+		t.Error("expected error for -tls-cert without -tls-key")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import "fmt"
+import "net"
+import "os"
+import "path/filepath"
+
+// isUnixProto reports whether proto is a Unix domain socket protocol.
+func isUnixProto(proto string) bool {
+	switch proto {
+	case "unix", "unixgram", "unixpacket":
+		return true
+	}
+	return false
+}
+
+// removeStaleSocket removes the Unix domain socket file at path, unless a
+// process is still listening on it. Files which are not sockets are never
+// removed.
+func removeStaleSocket(proto, path string) (err error) {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("nc: %s: file exists and is not a socket", path)
+	}
+	conn, err := net.Dial(proto, path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("nc: %s: socket is in use", path)
+	}
+	return os.Remove(path)
+}
+
+// dialUnixgram connects to the Unix datagram socket at path. The local end of
+// the connection is bound to a temporary socket file, so that the peer is able
+// to reply. The temporary socket file is removed on exit.
+func dialUnixgram(path string) (conn net.Conn, err error) {
+	raddr := &net.UnixAddr{Name: path, Net: "unixgram"}
+	laddr := &net.UnixAddr{
+		Name: filepath.Join(os.TempDir(), fmt.Sprintf("nc.%d.sock", os.Getpid())),
+		Net:  "unixgram",
+	}
+	c, err := net.DialUnix("unixgram", laddr, raddr)
+	if err != nil {
+		return nil, err
+	}
+	atExit(func() {
+		os.Remove(laddr.Name)
+	})
+	return c, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import "os"
+
+// ANSI escape sequences used to highlight byte classes.
+const (
+	colorNull       = "\x1B[90m"   // NUL bytes; bright black
+	colorPrintable  = "\x1B[36m"   // printable ASCII characters; cyan
+	colorWhitespace = "\x1B[32m"   // ASCII whitespace; green
+	colorControl    = "\x1B[35m"   // other ASCII control characters; magenta
+	colorHigh       = "\x1B[33m"   // non-ASCII bytes; yellow
+	colorDiff       = "\x1B[1;31m" // differing bytes; bold red
+	colorReset      = "\x1B[0m"
+)
+
+// byteColor returns the ANSI escape sequence used to highlight the class of c.
+func byteColor(c byte) string {
+	switch {
+	case c == 0:
+		return colorNull
+	case isSpace(c):
+		return colorWhitespace
+	case isPrint(c):
+		return colorPrintable
+	case c < 0x80:
+		return colorControl
+	}
+	return colorHigh
+}
+
+// useColor reports whether the output should be colorized, based on the
+// "-color" flag. In auto mode, color is only used if standard output is a
+// terminal and the NO_COLOR environment variable is not set.
+func useColor() bool {
+	switch flagColor {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
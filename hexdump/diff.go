@@ -0,0 +1,172 @@
+package main
+
+import "bufio"
+import "bytes"
+import "errors"
+import "fmt"
+import "io"
+import "os"
+
+// hexdumpDiff writes a hex dump of the differences between the two provided
+// files or standard input (when a file path is "-") to standard output, using
+// the provided format strings and block size. The "-s" and "-n" flags apply to
+// both files.
+//
+// Blocks which differ are output for both files, prefixed by "-" and "+"
+// respectively, with the differing bytes highlighted. Identical blocks are
+// replaced by a single line containing an asterisk. The offset of the first
+// difference and the total number of differing bytes are output last. The
+// returned differ value is true if the files differ.
+func hexdumpDiff(pathA, pathB string, fss []*formatString, blocksize int) (differ bool, err error) {
+	if flagOffset < 0 {
+		return false, errors.New("hexdump: negative offsets are not supported with -diff")
+	}
+	if blocksize == 0 {
+		return false, errors.New("hexdump: format strings interpret no data")
+	}
+	skip := int64(flagOffset)
+	n := int64(-1)
+	if flagLength != 0 {
+		// Interpret only x bytes if "-n" flag is used.
+		n = int64(flagLength)
+	}
+	ra := openStream(pathA, skip, n)
+	defer ra.Close()
+	rb := openStream(pathB, skip, n)
+	defer rb.Close()
+
+	w := bufio.NewWriter(os.Stdout)
+	fmt.Fprintf(w, "--- %s\n", pathA)
+	fmt.Fprintf(w, "+++ %s\n", pathB)
+	d := newDumper(w, fss, blocksize, skip, false, useColor())
+	a := make([]byte, blocksize)
+	b := make([]byte, blocksize)
+	mark := make([]bool, blocksize)
+	// Offset of the first difference, number of differing bytes, and total
+	// length of each file.
+	first, total, lenA, lenB := int64(-1), int64(0), int64(0), int64(0)
+	addr := skip
+	squeezed := false
+	for {
+		na, err := readBlock(ra, a)
+		if err != nil {
+			return false, err
+		}
+		nb, err := readBlock(rb, b)
+		if err != nil {
+			return false, err
+		}
+		if na == 0 && nb == 0 {
+			break
+		}
+		lenA += int64(na)
+		lenB += int64(nb)
+
+		// Mark differing bytes.
+		diff := false
+		for i := range mark {
+			mark[i] = (i < na || i < nb) && (i >= na || i >= nb || a[i] != b[i])
+			if !mark[i] {
+				continue
+			}
+			diff = true
+			if i < na && i < nb {
+				total++
+				if first == -1 {
+					first = addr + int64(i)
+				}
+			}
+		}
+
+		if !diff {
+			// Replace identical blocks by an asterisk.
+			if !squeezed {
+				w.WriteString("*\n")
+				squeezed = true
+			}
+		} else {
+			squeezed = false
+			d.addr = addr
+			spans := diffBlock(w, d, "- ", a, na, mark)
+			if spansB := diffBlock(w, d, "+ ", b, nb, mark); nb > na {
+				// Use the positions of the longer block, as the conversions
+				// of bytes past the end of input are blank.
+				spans = spansB
+			}
+			if len(spans) > 0 {
+				// Mark differing bytes below the block when highlighting is
+				// not done in color.
+				marker := bytes.Repeat([]byte{' '}, spans[len(spans)-1][1])
+				for _, span := range spans {
+					for i := span[0]; i < span[1]; i++ {
+						marker[i] = '^'
+					}
+				}
+				w.Write(marker)
+				w.WriteByte('\n')
+			}
+		}
+		if na > nb {
+			addr += int64(na)
+		} else {
+			addr += int64(nb)
+		}
+	}
+
+	// Output summary.
+	if first != -1 {
+		fmt.Fprintf(w, "first difference at offset 0x%08x; %d bytes differ\n", first, total)
+	}
+	switch {
+	case lenA < lenB:
+		fmt.Fprintf(w, "EOF on %s after %d bytes\n", pathA, lenA)
+	case lenB < lenA:
+		fmt.Fprintf(w, "EOF on %s after %d bytes\n", pathB, lenB)
+	}
+	differ = first != -1 || lenA != lenB
+	return differ, w.Flush()
+}
+
+// diffBlock writes the dump of a block, of which the first n bytes hold input
+// data, to w, prefixed by prefix. Bytes of mark are highlighted. If the dump of
+// the block is a single line and is not colorized, the positions of the
+// highlighted conversions within the line are returned.
+func diffBlock(w *bufio.Writer, d *dumper, prefix string, block []byte, n int, mark []bool) (spans [][2]int) {
+	// Zero-fill the remainder of the block.
+	for i := n; i < len(block); i++ {
+		block[i] = 0
+	}
+	out := new(bytes.Buffer)
+	out.WriteString(prefix)
+	d.mark, d.spans = mark, nil
+	d.display(out, block, n)
+	d.mark = nil
+	w.Write(out.Bytes())
+	if bytes.IndexByte(out.Bytes(), '\n') != out.Len()-1 {
+		// Only mark single line blocks.
+		return nil
+	}
+	return d.spans
+}
+
+// readBlock reads a block of data from r into buf. It returns the number of
+// bytes read, which is only less than the block size at the end of input.
+func readBlock(r io.Reader, buf []byte) (n int, err error) {
+	n, err = io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return n, nil
+	}
+	return n, err
+}
+
+// openStream returns a reader of the contents of the provided file or standard
+// input (when the provided file path is "-"), after skipping skip bytes from the
+// beginning of the file. At most n bytes are read, unless n is negative.
+func openStream(filePath string, skip, n int64) *io.PipeReader {
+	pr, pw := io.Pipe()
+	go func() {
+		_, _, err := copyFile(pw, filePath, skip, n)
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
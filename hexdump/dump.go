@@ -0,0 +1,340 @@
+package main
+
+import "bytes"
+import "encoding/binary"
+import "fmt"
+import "io"
+import "math"
+import "strings"
+
+// A dumper writes a formatted dump of the data written to it. The data is
+// split into blocks, and every format string is applied to each block.
+type dumper struct {
+	// Underlying writer of the dump.
+	w io.Writer
+	// Format strings applied to each block.
+	fss []*formatString
+	// Number of bytes in each block.
+	blocksize int
+	// Address of the current block.
+	addr int64
+	// Pending data of the current block.
+	buf []byte
+	// When squeeze is true, consecutive identical blocks are replaced by a
+	// single line containing an asterisk.
+	squeeze bool
+	// Data of the previous block, or nil if no block has been displayed.
+	prev []byte
+	// squeezed is true if the previous block was replaced by an asterisk.
+	squeezed bool
+	// When color is true, single byte conversions are highlighted according to
+	// the class of the byte.
+	color bool
+	// Bytes of the displayed block which are marked as different; or nil if no
+	// bytes are marked. Conversions of marked bytes are highlighted when color
+	// is true, and their output ranges recorded in spans otherwise.
+	mark []bool
+	// Output ranges of the conversions of marked bytes, as start and end
+	// offsets into the output buffer.
+	spans [][2]int
+}
+
+// newDumper returns a new dumper which writes a dump of the data written to it
+// to w, using the provided format strings and block size. The address of the
+// first byte is addr. When squeeze is true, blocks identical to the previous
+// block are replaced by a single line containing an asterisk. When color is
+// true, single byte conversions are highlighted according to the class of the
+// byte.
+//
+// The dumper must be closed to write the dump of any incomplete final block.
+func newDumper(w io.Writer, fss []*formatString, blocksize int, addr int64, squeeze, color bool) *dumper {
+	d := &dumper{
+		w:         w,
+		fss:       fss,
+		blocksize: blocksize,
+		addr:      addr,
+		buf:       make([]byte, 0, blocksize),
+		squeeze:   squeeze,
+		color:     color,
+	}
+	return d
+}
+
+// Write writes a dump of all complete blocks of data to the underlying writer.
+// Any remaining data is kept until the block is complete or the dumper is
+// closed.
+func (d *dumper) Write(p []byte) (n int, err error) {
+	if d.blocksize == 0 {
+		// The format strings interpret no data.
+		d.addr += int64(len(p))
+		return len(p), nil
+	}
+	out := new(bytes.Buffer)
+	n = len(p)
+	for len(p) > 0 {
+		m := copy(d.buf[len(d.buf):d.blocksize], p)
+		d.buf = d.buf[:len(d.buf)+m]
+		p = p[m:]
+		if len(d.buf) == d.blocksize {
+			d.displayBlock(out)
+		}
+	}
+	_, err = d.w.Write(out.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Close writes a dump of any incomplete final block, followed by the %_A
+// conversions of the format strings.
+func (d *dumper) Close() (err error) {
+	out := new(bytes.Buffer)
+	if len(d.buf) > 0 {
+		n := len(d.buf)
+		// Zero-fill the remainder of the block.
+		block := d.buf[:d.blocksize]
+		for i := n; i < len(block); i++ {
+			block[i] = 0
+		}
+		d.display(out, block, n)
+		d.addr += int64(n)
+		d.buf = d.buf[:0]
+	}
+	if d.addr != 0 {
+		for _, fs := range d.fss {
+			for _, fu := range fs.units {
+				if !fu.end {
+					continue
+				}
+				for _, pr := range fu.prs {
+					switch pr.kind {
+					case kindText:
+						out.WriteString(pr.text)
+					case kindAddress, kindEndAddress:
+						fmt.Fprintf(out, pr.verb, d.addr)
+					}
+				}
+				break
+			}
+		}
+	}
+	_, err = d.w.Write(out.Bytes())
+	return err
+}
+
+// displayBlock writes a dump of the current complete block to out, unless it is
+// squeezed.
+func (d *dumper) displayBlock(out *bytes.Buffer) {
+	switch {
+	case d.squeeze && d.prev != nil && bytes.Equal(d.buf, d.prev):
+		if !d.squeezed {
+			out.WriteString("*\n")
+			d.squeezed = true
+		}
+	default:
+		d.display(out, d.buf, len(d.buf))
+		d.squeezed = false
+	}
+	if d.squeeze {
+		// Swap buffers to keep the data of the previous block.
+		if d.prev == nil {
+			d.prev = make([]byte, d.blocksize)
+		}
+		d.prev, d.buf = d.buf, d.prev[:0]
+	} else {
+		d.buf = d.buf[:0]
+	}
+	d.addr += int64(d.blocksize)
+}
+
+// display writes a dump of the provided block to out, where n is the number of
+// bytes of the block which hold input data. Conversions of bytes past the end
+// of input are replaced by blank space of the same field width.
+func (d *dumper) display(out *bytes.Buffer, block []byte, n int) {
+	for _, fs := range d.fss {
+		off := 0
+		for _, fu := range fs.units {
+			if fu.end {
+				// Skip the remaining format units; they are output once all
+				// input has been processed.
+				break
+			}
+			for rep := 1; rep <= fu.reps; rep++ {
+				for i, pr := range fu.prs {
+					switch {
+					case pr.kind == kindText:
+						text := pr.text
+						if fu.reps > 1 && rep == fu.reps && i == len(fu.prs)-1 && isSpace(text[len(text)-1]) {
+							// No trailing whitespace is output during the
+							// last iteration of repeated format units.
+							text = text[:len(text)-1]
+						}
+						out.WriteString(text)
+					case off >= n:
+						// Past the end of input.
+						out.WriteString(strings.Repeat(" ", pr.width))
+					case d.mark != nil && pr.size > 0 && marked(d.mark[off:off+pr.size]):
+						if d.color {
+							out.WriteString(colorDiff)
+							pr.print(out, block[off:off+pr.size], d.addr+int64(off))
+							out.WriteString(colorReset)
+							break
+						}
+						start := out.Len()
+						pr.print(out, block[off:off+pr.size], d.addr+int64(off))
+						d.spans = append(d.spans, [2]int{start, out.Len()})
+					case d.color && pr.size == 1:
+						// Escape sequences are added around the padded field,
+						// to keep the columns aligned.
+						out.WriteString(byteColor(block[off]))
+						pr.print(out, block[off:off+1], d.addr+int64(off))
+						out.WriteString(colorReset)
+					default:
+						pr.print(out, block[off:off+pr.size], d.addr+int64(off))
+					}
+					off += pr.size
+				}
+			}
+		}
+	}
+}
+
+// marked reports whether any of the provided bytes are marked as different.
+func marked(mark []bool) bool {
+	for _, m := range mark {
+		if m {
+			return true
+		}
+	}
+	return false
+}
+
+// print writes the conversion of the provided bytes to out, where addr is the
+// address of the first byte.
+func (pr *printer) print(out *bytes.Buffer, b []byte, addr int64) {
+	switch pr.kind {
+	case kindAddress, kindEndAddress:
+		fmt.Fprintf(out, pr.verb, addr)
+	case kindInt:
+		fmt.Fprintf(out, pr.verb, signed(b))
+	case kindUint:
+		fmt.Fprintf(out, pr.verb, unsigned(b))
+	case kindFloat:
+		var v float64
+		if len(b) == 4 {
+			v = float64(math.Float32frombits(binary.NativeEndian.Uint32(b)))
+		} else {
+			v = math.Float64frombits(binary.NativeEndian.Uint64(b))
+		}
+		fmt.Fprintf(out, pr.verb, v)
+	case kindChar:
+		fmt.Fprintf(out, pr.verb, string(b[:1]))
+	case kindString:
+		if i := bytes.IndexByte(b, 0); i != -1 {
+			b = b[:i]
+		}
+		fmt.Fprintf(out, pr.verb, b)
+	case kindCharEscape:
+		fmt.Fprintf(out, pr.verb, charEscape(b[0]))
+	case kindPrintable:
+		c := b[0]
+		if !isPrint(c) {
+			c = '.'
+		}
+		fmt.Fprintf(out, pr.verb, string(c))
+	case kindASCIIName:
+		fmt.Fprintf(out, pr.verb, asciiName(b[0]))
+	}
+}
+
+// signed returns the signed integer stored in native byte order in b.
+func signed(b []byte) int64 {
+	switch len(b) {
+	case 1:
+		return int64(int8(b[0]))
+	case 2:
+		return int64(int16(binary.NativeEndian.Uint16(b)))
+	case 4:
+		return int64(int32(binary.NativeEndian.Uint32(b)))
+	default:
+		return int64(binary.NativeEndian.Uint64(b))
+	}
+}
+
+// unsigned returns the unsigned integer stored in native byte order in b.
+func unsigned(b []byte) uint64 {
+	switch len(b) {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(binary.NativeEndian.Uint16(b))
+	case 4:
+		return uint64(binary.NativeEndian.Uint32(b))
+	default:
+		return binary.NativeEndian.Uint64(b)
+	}
+}
+
+// charEscape returns c as a printable character, a C escape sequence or a
+// three digit octal number.
+func charEscape(c byte) string {
+	switch c {
+	case 0:
+		return `\0`
+	case '\a':
+		return `\a`
+	case '\b':
+		return `\b`
+	case '\f':
+		return `\f`
+	case '\n':
+		return `\n`
+	case '\r':
+		return `\r`
+	case '\t':
+		return `\t`
+	case '\v':
+		return `\v`
+	}
+	if isPrint(c) {
+		return string(c)
+	}
+	return fmt.Sprintf("%03o", c)
+}
+
+// asciiNames holds the lower-case US ASCII names of control characters.
+var asciiNames = [...]string{
+	"nul", "soh", "stx", "etx", "eot", "enq", "ack", "bel",
+	"bs", "ht", "lf", "vt", "ff", "cr", "so", "si",
+	"dle", "dc1", "dc2", "dc3", "dc4", "nak", "syn", "etb",
+	"can", "em", "sub", "esc", "fs", "gs", "rs", "us",
+}
+
+// asciiName returns c as a printable character, the US ASCII name of a control
+// character, or a hexadecimal number for bytes outside of US ASCII.
+func asciiName(c byte) string {
+	switch {
+	case int(c) < len(asciiNames):
+		return asciiNames[c]
+	case c == 0x7F:
+		return "del"
+	case c > 0x7F:
+		return fmt.Sprintf("%02x", c)
+	}
+	return string(c)
+}
+
+// isPrint reports whether c is a printable US ASCII character.
+func isPrint(c byte) bool {
+	return ' ' <= c && c <= '~'
+}
+
+// isSpace reports whether c is a whitespace character.
+func isSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package main
+
+import "bufio"
+import "bytes"
+import "encoding/hex"
+import "errors"
+import "fmt"
+import "io"
+import "os"
+import "strings"
+
+// hexdumpFind searches the concatenation of the provided files or standard
+// input (when a file path is "-") for the provided byte pattern, and writes the
+// offset of each match to standard output. If context is non-zero, each offset
+// is followed by a hex dump of the match and context bytes before and after
+// it, using the provided format strings and block size. The "-s" and "-n"
+// flags apply to the concatenated stream. The returned found value is true if
+// any match was found.
+func hexdumpFind(filePaths []string, pattern []byte, context int, fss []*formatString, blocksize int) (found bool, err error) {
+	skip := int64(flagOffset)
+	n := int64(-1)
+	if flagLength != 0 {
+		// Interpret only x bytes if "-n" flag is used.
+		n = int64(flagLength)
+	}
+	if skip < 0 {
+		// Count offset from the end of input.
+		size, ok, err := totalSize(filePaths)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, errors.New("hexdump: negative offsets of unseekable input are not supported with -find")
+		}
+		skip += size
+		if skip < 0 {
+			skip = 0
+		}
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	f := newFinder(w, pattern, context, fss, blocksize, skip)
+	_, err = copyFiles(f, filePaths, skip, n)
+	if err != nil {
+		return false, err
+	}
+	err = f.Close()
+	if err != nil {
+		return false, err
+	}
+	return f.matches > 0, w.Flush()
+}
+
+// A finder searches the data written to it for a byte pattern, and writes the
+// offset of each match to w, optionally followed by a hex dump of the match
+// and its surrounding bytes.
+//
+// Only the data required to find matches spanning writes and to output the
+// context of matches is kept in memory, which allows streams larger than
+// memory to be searched.
+type finder struct {
+	// Output of the finder.
+	w io.Writer
+	// Byte pattern searched for.
+	pattern []byte
+	// Number of context bytes dumped before and after each match.
+	context int
+	// Format strings and block size used to dump the context of matches.
+	fss       []*formatString
+	blocksize int
+	// Offset of the first byte of input.
+	start int64
+	// Window of input data kept in memory, and the offset of its first byte.
+	win      []byte
+	winStart int64
+	// Offset from which to continue searching.
+	next int64
+	// Offsets of matches waiting for their trailing context.
+	pending []int64
+	// Number of matches found.
+	matches int
+}
+
+// newFinder returns a new finder which searches the data written to it for the
+// provided pattern, where addr is the offset of the first byte written.
+func newFinder(w io.Writer, pattern []byte, context int, fss []*formatString, blocksize int, addr int64) *finder {
+	f := &finder{
+		w:         w,
+		pattern:   pattern,
+		context:   context,
+		fss:       fss,
+		blocksize: blocksize,
+		start:     addr,
+		winStart:  addr,
+		next:      addr,
+	}
+	return f
+}
+
+// Write searches p, and any data kept from previous writes, for the pattern.
+func (f *finder) Write(p []byte) (n int, err error) {
+	f.win = append(f.win, p...)
+	end := f.winStart + int64(len(f.win))
+	for {
+		i := bytes.Index(f.win[f.next-f.winStart:], f.pattern)
+		if i == -1 {
+			break
+		}
+		off := f.next + int64(i)
+		f.pending = append(f.pending, off)
+		f.matches++
+		f.next = off + 1
+	}
+	// Continue searching where a match may span the end of the current data.
+	if next := end - int64(len(f.pattern)-1); next > f.next {
+		f.next = next
+	}
+
+	// Output matches with complete trailing context.
+	err = f.output(false)
+	if err != nil {
+		return 0, err
+	}
+
+	// Discard data which is no longer needed, keeping the leading context of
+	// future matches.
+	keep := f.next - int64(f.context)
+	if len(f.pending) > 0 && f.pending[0]-int64(f.context) < keep {
+		keep = f.pending[0] - int64(f.context)
+	}
+	if keep > f.winStart && keep-f.winStart >= int64(len(f.win)/2) {
+		k := copy(f.win, f.win[keep-f.winStart:])
+		f.win = f.win[:k]
+		f.winStart = keep
+	}
+	return len(p), nil
+}
+
+// Close outputs any matches still waiting for their trailing context.
+func (f *finder) Close() error {
+	return f.output(true)
+}
+
+// output writes the pending matches whose trailing context is complete to the
+// output of the finder. If final is true, all pending matches are written.
+func (f *finder) output(final bool) (err error) {
+	end := f.winStart + int64(len(f.win))
+	for len(f.pending) > 0 {
+		off := f.pending[0]
+		ctxEnd := off + int64(len(f.pattern)+f.context)
+		if ctxEnd > end {
+			if !final {
+				break
+			}
+			ctxEnd = end
+		}
+		f.pending = f.pending[1:]
+		_, err = fmt.Fprintf(f.w, "%08x\n", off)
+		if err != nil {
+			return err
+		}
+		if f.context == 0 {
+			continue
+		}
+		ctxStart := off - int64(f.context)
+		if ctxStart < f.start {
+			ctxStart = f.start
+		}
+		d := newDumper(f.w, f.fss, f.blocksize, ctxStart, false, useColor())
+		_, err = d.Write(f.win[ctxStart-f.winStart : ctxEnd-f.winStart])
+		if err != nil {
+			return err
+		}
+		err = d.Close()
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(f.w, "--\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parsePattern parses the provided search pattern. Patterns starting with "0x"
+// are hex byte sequences, in which spaces are ignored; other patterns are
+// literal strings.
+func parsePattern(s string) (pattern []byte, err error) {
+	if strings.HasPrefix(s, "0x") {
+		pattern, err = hex.DecodeString(strings.Replace(s[2:], " ", "", -1))
+		if err != nil {
+			return nil, fmt.Errorf("hexdump: invalid hex pattern %q; %v", s, err)
+		}
+	} else {
+		pattern = []byte(s)
+	}
+	if len(pattern) == 0 {
+		return nil, errors.New("hexdump: empty search pattern")
+	}
+	return pattern, nil
+}
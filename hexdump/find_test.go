@@ -0,0 +1,66 @@
+package main
+
+import "strings"
+import "testing"
+
+func TestFinder(t *testing.T) {
+	defer func(color string) { flagColor = color }(flagColor)
+	flagColor = "never"
+	fss, blocksize, err := parseFormats([]string{`"%04_ax:" 4/1 " %02x" "\n"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden := []struct {
+		name    string
+		in      string
+		pattern string
+		context int
+		addr    int64
+		want    string
+	}{
+		{name: "no match", in: "abc", pattern: "x", want: ""},
+		{name: "overlapping", in: "aaaa", pattern: "aa", want: "00000000\n00000001\n00000002\n"},
+		{name: "overlapping period", in: "xxabcabcabc", pattern: "abcabc", want: "00000002\n00000005\n"},
+		{name: "spanning", in: "hello world, hello", pattern: "hello", want: "00000000\n0000000d\n"},
+		{
+			name: "context", in: "0123456789abcdef", pattern: "89", context: 2,
+			want: "00000008\n0006: 36 37 38 39\n000a: 61 62      \n--\n",
+		},
+		{
+			name: "overlapping context", in: "xxabyyabzz", pattern: "ab", context: 2,
+			want: "00000002\n0000: 78 78 61 62\n0004: 79 79      \n--\n" +
+				"00000006\n0004: 79 79 61 62\n0008: 7a 7a      \n--\n",
+		},
+		{
+			name: "truncated context", in: "0123456789abcdef01", pattern: "01", context: 3, addr: 0x10,
+			want: "00000010\n0010: 30 31 32 33\n0014: 34         \n--\n" +
+				"00000020\n001d: 64 65 66 30\n0021: 31         \n--\n",
+		},
+	}
+	for _, g := range golden {
+		// Matches and their context are found regardless of how the input is
+		// split across writes.
+		for size := 1; size <= len(g.in); size++ {
+			buf := new(strings.Builder)
+			f := newFinder(buf, []byte(g.pattern), g.context, fss, blocksize, g.addr)
+			for i := 0; i < len(g.in); i += size {
+				end := i + size
+				if end > len(g.in) {
+					end = len(g.in)
+				}
+				_, err := f.Write([]byte(g.in[i:end]))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := f.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != g.want {
+				t.Errorf("%s, %d-byte writes: expected %q, got %q", g.name, size, g.want, got)
+			}
+		}
+	}
+}
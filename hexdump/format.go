@@ -0,0 +1,447 @@
+package main
+
+import "bufio"
+import "fmt"
+import "os"
+import "strconv"
+import "strings"
+
+// Format strings of the predefined display formats.
+var (
+	// formatOctalBytes is the format of the "-b" flag; one-byte octal display.
+	formatOctalBytes = []string{
+		`"%07.7_Ax\n"`,
+		`"%07.7_ax " 16/1 "%03o " "\n"`,
+	}
+	// formatChars is the format of the "-c" flag; one-byte character display.
+	formatChars = []string{
+		`"%07.7_Ax\n"`,
+		`"%07.7_ax " 16/1 "%3_c " "\n"`,
+	}
+	// formatCanonical is the format of the "-C" flag; canonical hex+ASCII
+	// display.
+	formatCanonical = []string{
+		`"%08.8_Ax\n"`,
+		`"%08.8_ax  " 8/1 "%02x " "  " 8/1 "%02x "`,
+		`"  |" 16/1 "%_p" "|\n"`,
+	}
+	// formatDecimal is the format of the "-d" flag; two-byte decimal display.
+	formatDecimal = []string{
+		`"%07.7_Ax\n"`,
+		`"%07.7_ax " 8/2 "  %05u " "\n"`,
+	}
+	// formatOctal is the format of the "-o" flag; two-byte octal display.
+	formatOctal = []string{
+		`"%07.7_Ax\n"`,
+		`"%07.7_ax " 8/2 " %06o " "\n"`,
+	}
+	// formatHex is the format of the "-x" flag; two-byte hexadecimal display.
+	formatHex = []string{
+		`"%07.7_Ax\n"`,
+		`"%07.7_ax " 8/2 "   %04x " "\n"`,
+	}
+)
+
+// A formatString is a parsed format string, which consists of a sequence of
+// format units. Every format string is applied to each block of input.
+type formatString struct {
+	units []*formatUnit
+}
+
+// A formatUnit is a parsed format unit, which consists of an iteration count,
+// a byte count and a format.
+type formatUnit struct {
+	// Number of times the format is applied.
+	reps int
+	// hasReps is true if the iteration count was specified explicitly.
+	hasReps bool
+	// Number of bytes interpreted by each iteration of the format; or 0 if no
+	// byte count was specified.
+	bcnt int
+	// Text and conversions of the format.
+	prs []*printer
+	// end is true if the format contains an %_A conversion, in which case the
+	// format unit and any following format units of the format string are only
+	// output once all input has been processed.
+	end bool
+}
+
+// A printer is a single conversion or a piece of literal text of a format.
+type printer struct {
+	// Kind of conversion.
+	kind convKind
+	// Literal text of kindText printers.
+	text string
+	// Go format specification of the conversion.
+	verb string
+	// Minimum field width of the conversion.
+	width int
+	// Number of bytes interpreted by the conversion.
+	size int
+}
+
+// convKind specifies the kind of a conversion.
+type convKind int
+
+// Conversion kinds.
+const (
+	kindText       convKind = iota // literal text
+	kindAddress                    // %_a[dox]; offset of the next byte
+	kindEndAddress                 // %_A[dox]; offset once all input is processed
+	kindInt                        // %d, %i
+	kindUint                       // %o, %u, %x, %X
+	kindFloat                      // %e, %E, %f, %g, %G
+	kindChar                       // %c
+	kindString                     // %s
+	kindCharEscape                 // %_c; character or C escape
+	kindPrintable                  // %_p; printable character or '.'
+	kindASCIIName                  // %_u; character or US ASCII name
+)
+
+// size returns the number of bytes interpreted by each iteration of the
+// format unit.
+func (fu *formatUnit) size() (n int) {
+	for _, pr := range fu.prs {
+		n += pr.size
+	}
+	return n
+}
+
+// size returns the number of bytes interpreted by the format string.
+func (fs *formatString) size() (n int) {
+	for _, fu := range fs.units {
+		n += fu.reps * fu.size()
+	}
+	return n
+}
+
+// parseFormats parses the provided format strings. It returns the parsed
+// format strings and the block size, which is the number of bytes interpreted
+// by the largest format string.
+//
+// If a format string interprets fewer bytes than the block size, and its last
+// format unit has no explicit iteration count, the last format unit is
+// repeated as necessary to fill the block.
+func parseFormats(formats []string) (fss []*formatString, blocksize int, err error) {
+	for _, format := range formats {
+		fs, err := parseFormat(format)
+		if err != nil {
+			return nil, 0, err
+		}
+		fss = append(fss, fs)
+		if n := fs.size(); n > blocksize {
+			blocksize = n
+		}
+	}
+	for _, fs := range fss {
+		if len(fs.units) == 0 {
+			continue
+		}
+		last := fs.units[len(fs.units)-1]
+		n := fs.size()
+		if size := last.size(); n < blocksize && !last.hasReps && size > 0 {
+			last.reps += (blocksize - n) / size
+		}
+	}
+	return fss, blocksize, nil
+}
+
+// parseFormat parses the provided format string, which consists of a sequence
+// of format units of the form
+//
+//	[iteration_count]/[byte_count] "format"
+func parseFormat(format string) (fs *formatString, err error) {
+	fs = new(formatString)
+	s := format
+	for {
+		s = strings.TrimLeft(s, " \t\n")
+		if s == "" {
+			return fs, nil
+		}
+		fu := &formatUnit{reps: 1}
+
+		// Parse iteration count.
+		if isDigit(s[0]) {
+			fu.reps, s = leadingInt(s)
+			if fu.reps < 1 {
+				return nil, fmt.Errorf("%q: bad iteration count", format)
+			}
+			fu.hasReps = true
+			s = strings.TrimLeft(s, " \t\n")
+		}
+
+		// Parse byte count.
+		if strings.HasPrefix(s, "/") {
+			s = strings.TrimLeft(s[1:], " \t\n")
+			if s == "" || !isDigit(s[0]) {
+				return nil, fmt.Errorf("%q: bad byte count", format)
+			}
+			fu.bcnt, s = leadingInt(s)
+			if fu.bcnt < 1 {
+				return nil, fmt.Errorf("%q: bad byte count", format)
+			}
+			s = strings.TrimLeft(s, " \t\n")
+		}
+
+		// Parse format.
+		if !strings.HasPrefix(s, `"`) {
+			return nil, fmt.Errorf("%q: bad format; expected quoted string", format)
+		}
+		end := 1
+		for ; end < len(s) && s[end] != '"'; end++ {
+			if s[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(s) {
+			return nil, fmt.Errorf("%q: bad format; missing closing quote", format)
+		}
+		fu.prs, err = parseUnit(unescape(s[1:end]), fu.bcnt)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", format, err)
+		}
+		for _, pr := range fu.prs {
+			if pr.kind == kindEndAddress {
+				fu.end = true
+			}
+		}
+		fs.units = append(fs.units, fu)
+		s = s[end+1:]
+	}
+}
+
+// parseUnit parses the format of a format unit into its text and conversions.
+// If bcnt is non-zero, it specifies the number of bytes interpreted by the
+// format, in which case the format may contain at most one conversion which
+// interprets data.
+func parseUnit(format string, bcnt int) (prs []*printer, err error) {
+	text := new(strings.Builder)
+	var data *printer
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			text.WriteByte(format[i])
+			continue
+		}
+		if strings.HasPrefix(format[i:], "%%") {
+			text.WriteByte('%')
+			i++
+			continue
+		}
+		if text.Len() > 0 {
+			prs = append(prs, &printer{kind: kindText, text: text.String()})
+			text.Reset()
+		}
+		pr, n, err := parseConv(format[i:], bcnt)
+		if err != nil {
+			return nil, err
+		}
+		if pr.size > 0 {
+			if data != nil && bcnt != 0 {
+				return nil, fmt.Errorf("byte count with multiple conversion characters")
+			}
+			data = pr
+		}
+		prs = append(prs, pr)
+		i += n - 1
+	}
+	if text.Len() > 0 {
+		prs = append(prs, &printer{kind: kindText, text: text.String()})
+	}
+	return prs, nil
+}
+
+// parseConv parses the conversion specification at the start of spec. It
+// returns the parsed conversion and the length of the specification. If bcnt
+// is non-zero, it overrides the number of bytes interpreted by the conversion.
+func parseConv(spec string, bcnt int) (pr *printer, n int, err error) {
+	// Parse flags, field width and precision.
+	i := 1
+	for i < len(spec) && strings.IndexByte("-+ #0", spec[i]) != -1 {
+		i++
+	}
+	flags := spec[1:i]
+	start := i
+	for i < len(spec) && isDigit(spec[i]) {
+		i++
+	}
+	width := spec[start:i]
+	prec := ""
+	hasPrec := false
+	if i < len(spec) && spec[i] == '.' {
+		hasPrec = true
+		i++
+		start := i
+		for i < len(spec) && isDigit(spec[i]) {
+			i++
+		}
+		prec = spec[start:i]
+		if prec == "" {
+			prec = "0"
+		}
+	}
+	if i >= len(spec) {
+		return nil, 0, fmt.Errorf("%s: missing conversion character", spec)
+	}
+
+	pr = new(printer)
+	pr.width, _ = strconv.Atoi(width)
+	verb := "%" + flags + width
+	if hasPrec {
+		verb += "." + prec
+	}
+	// strVerb is the format specification of conversions which output
+	// strings, for which the precision has no meaning.
+	strVerb := "%" + flags + width + "s"
+	c := spec[i]
+	i++
+	switch c {
+	case '_':
+		if i >= len(spec) {
+			return nil, 0, fmt.Errorf("%s: missing conversion character", spec)
+		}
+		c = spec[i]
+		i++
+		switch c {
+		case 'a', 'A':
+			pr.kind = kindAddress
+			if c == 'A' {
+				pr.kind = kindEndAddress
+			}
+			if i >= len(spec) || strings.IndexByte("dox", spec[i]) == -1 {
+				return nil, 0, fmt.Errorf("%s: bad conversion character %%_%c", spec[:i], c)
+			}
+			pr.verb = verb + spec[i:i+1]
+			i++
+		case 'c':
+			pr.kind, pr.verb, pr.size = kindCharEscape, strVerb, 1
+		case 'p':
+			pr.kind, pr.verb, pr.size = kindPrintable, strVerb, 1
+		case 'u':
+			pr.kind, pr.verb, pr.size = kindASCIIName, strVerb, 1
+		default:
+			return nil, 0, fmt.Errorf("%s: bad conversion character %%_%c", spec[:i], c)
+		}
+	case 'c':
+		pr.kind, pr.verb, pr.size = kindChar, strVerb, 1
+	case 'd', 'i':
+		pr.kind, pr.verb, pr.size = kindInt, verb+"d", 4
+	case 'o', 'u', 'x', 'X':
+		if c == 'u' {
+			c = 'd'
+		}
+		pr.kind, pr.verb, pr.size = kindUint, verb+string(c), 4
+	case 'e', 'E', 'f', 'g', 'G':
+		if !hasPrec {
+			// Go uses the smallest number of digits necessary for %g, whereas
+			// C uses a default precision of 6 for all floating-point
+			// conversions.
+			verb += ".6"
+		}
+		pr.kind, pr.verb, pr.size = kindFloat, verb+string(c), 8
+	case 's':
+		pr.kind, pr.verb = kindString, strVerb
+		switch {
+		case hasPrec:
+			pr.size, _ = strconv.Atoi(prec)
+		case bcnt != 0:
+			pr.size = bcnt
+		default:
+			return nil, 0, fmt.Errorf("%s: %%s requires a precision or a byte count", spec[:i])
+		}
+	default:
+		return nil, 0, fmt.Errorf("%s: bad conversion character %%%c", spec[:i], c)
+	}
+
+	// Validate byte count.
+	if bcnt != 0 && pr.size > 0 {
+		valid := true
+		switch pr.kind {
+		case kindChar, kindCharEscape, kindPrintable, kindASCIIName:
+			valid = bcnt == 1
+		case kindInt, kindUint:
+			valid = bcnt == 1 || bcnt == 2 || bcnt == 4 || bcnt == 8
+		case kindFloat:
+			valid = bcnt == 4 || bcnt == 8
+		}
+		if !valid {
+			return nil, 0, fmt.Errorf("%s: bad byte count %d for conversion", spec[:i], bcnt)
+		}
+		if pr.kind != kindString || !hasPrec {
+			pr.size = bcnt
+		}
+	}
+	return pr, i, nil
+}
+
+// unescape returns s with its backslash escapes interpreted.
+func unescape(s string) string {
+	buf := new(strings.Builder)
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			buf.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch c := s[i]; c {
+		case '0':
+			buf.WriteByte(0)
+		case 'a':
+			buf.WriteByte('\a')
+		case 'b':
+			buf.WriteByte('\b')
+		case 'f':
+			buf.WriteByte('\f')
+		case 'n':
+			buf.WriteByte('\n')
+		case 'r':
+			buf.WriteByte('\r')
+		case 't':
+			buf.WriteByte('\t')
+		case 'v':
+			buf.WriteByte('\v')
+		default:
+			// Backslash and double quote escapes, or unknown escapes which
+			// output the character itself.
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+// loadFormats returns the format strings contained within the provided file,
+// one per line. Empty lines and lines starting with '#' are ignored.
+func loadFormats(filePath string) (formats []string, err error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		formats = append(formats, line)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return formats, nil
+}
+
+// leadingInt parses the leading decimal digits of s. It returns the parsed
+// value and the remainder of s.
+func leadingInt(s string) (v int, rest string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		v = v*10 + int(s[i]-'0')
+		i++
+	}
+	return v, s[i:]
+}
+
+// isDigit reports whether c is a decimal digit.
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -1,116 +1,356 @@
 package main
 
-import "encoding/hex"
 import "flag"
 import "fmt"
 import "io"
 import "log"
+import "math"
 import "os"
+import "strconv"
+import "strings"
 
 // flagLength is the number of bytes which should be interpreted. 0 corresponds
 // to the entire input.
-var flagLength int64
+var flagLength byteCount
 
 // flagOffset is the number of bytes which should be skipped from the beginning
-// of the input.
-var flagOffset int64
+// of the input. A negative offset is counted from the end of the input.
+var flagOffset byteCount
+
+// byteCount is a number of bytes, which may be followed by a unit suffix.
+type byteCount int64
+
+// byteUnits maps unit suffixes to their number of bytes, with longer suffixes
+// first.
+var byteUnits = []struct {
+	suffix string
+	n      int64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"kB", 1e3}, {"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"k", 1 << 10}, {"K", 1 << 10}, {"m", 1 << 20}, {"M", 1 << 20},
+	{"g", 1 << 30}, {"G", 1 << 30}, {"t", 1 << 40}, {"T", 1 << 40},
+}
+
+func (c *byteCount) String() string {
+	return strconv.FormatInt(int64(*c), 10)
+}
+
+func (c *byteCount) Set(v string) (err error) {
+	s, unit := v, int64(1)
+	for _, u := range byteUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSuffix(s, u.suffix), u.n
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 0, 64)
+	if err != nil {
+		return err
+	}
+	if n > math.MaxInt64/unit || n < math.MinInt64/unit {
+		return fmt.Errorf("%q: %v", v, strconv.ErrRange)
+	}
+	*c = byteCount(n * unit)
+	return nil
+}
+
+// When flagVerbose is true, display all input data. Otherwise, consecutive
+// identical blocks of input are replaced by a single line containing an
+// asterisk.
+var flagVerbose bool
+
+// When flagPerFile is true, output a separate hex dump of each file, and apply
+// the "-s" and "-n" flags to each file. Otherwise, the files are treated as a
+// single continuous stream of input.
+var flagPerFile bool
+
+// When flagDiff is true, output a hex dump of the differences between two
+// files.
+var flagDiff bool
+
+// flagFind is the byte pattern to search for; either a hex byte sequence
+// prefixed by "0x", or a string.
+var flagFind string
+
+// flagContext is the number of bytes before and after each match of "-find"
+// which should be dumped.
+var flagContext int
+
+// flagColor specifies when to colorize the output; one of "auto", "always" or
+// "never".
+var flagColor string
+
+// formats holds the format strings used to display the input, in the order
+// specified on the command line.
+var formats []string
+
+// formatFlag is a boolean flag which adds a predefined display format when set.
+type formatFlag []string
+
+func (f formatFlag) String() string {
+	return "false"
+}
+
+func (f formatFlag) Set(v string) (err error) {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return err
+	}
+	if b {
+		formats = append(formats, f...)
+	}
+	return nil
+}
+
+func (f formatFlag) IsBoolFlag() bool {
+	return true
+}
+
+// formatExpr is a flag which adds a format string to the display formats.
+type formatExpr struct{}
+
+func (formatExpr) String() string {
+	return ""
+}
+
+func (formatExpr) Set(v string) error {
+	formats = append(formats, v)
+	return nil
+}
+
+// formatFile is a flag which adds the format strings of a file to the display
+// formats.
+type formatFile struct{}
+
+func (formatFile) String() string {
+	return ""
+}
+
+func (formatFile) Set(v string) (err error) {
+	fs, err := loadFormats(v)
+	if err != nil {
+		return err
+	}
+	formats = append(formats, fs...)
+	return nil
+}
 
 func init() {
-	flag.Int64Var(&flagLength, "n", 0, "Interpret only x bytes of input.")
-	flag.Int64Var(&flagOffset, "s", 0, "Skip x bytes from the beginning of the input.")
+	flag.Var(&flagLength, "n", "Interpret only x bytes of input.")
+	flag.Var(&flagOffset, "s", "Skip x bytes from the beginning of the input; count from the end if negative.")
+	flag.BoolVar(&flagPerFile, "per-file", false, "Dump each file separately, with offsets starting at zero for each file.")
+	flag.BoolVar(&flagDiff, "diff", false, "Output a hex dump of the differences between two files.")
+	flag.StringVar(&flagFind, "find", "", "Output the offset of each match of `PATTERN`; a hex byte sequence prefixed by 0x, or a string.")
+	flag.IntVar(&flagContext, "context", 0, "Dump x bytes of context around each match of -find.")
+	flag.StringVar(&flagColor, "color", "auto", "Colorize output by byte class; auto, always or never.")
+	flag.BoolVar(&flagVerbose, "v", false, "Display all input data; do not replace duplicate lines with '*'.")
+	flag.Var(formatFlag(formatOctalBytes), "b", "One-byte octal display.")
+	flag.Var(formatFlag(formatChars), "c", "One-byte character display.")
+	flag.Var(formatFlag(formatCanonical), "C", "Canonical hex+ASCII display (default).")
+	flag.Var(formatFlag(formatDecimal), "d", "Two-byte decimal display.")
+	flag.Var(formatFlag(formatOctal), "o", "Two-byte octal display.")
+	flag.Var(formatFlag(formatHex), "x", "Two-byte hexadecimal display.")
+	flag.Var(formatExpr{}, "e", "Display input using the format string `FORMAT`.")
+	flag.Var(formatFile{}, "f", "Display input using the format strings of `FILE`, one per line.")
 	flag.Usage = usage
 }
 
 func usage() {
 	fmt.Fprintln(os.Stderr, "Usage: hexdump [OPTION]... [FILE]...")
+	fmt.Fprintln(os.Stderr, "  or:  hexdump -diff [OPTION]... FILE1 FILE2")
+	fmt.Fprintln(os.Stderr, "  or:  hexdump -find PATTERN [OPTION]... [FILE]...")
 	fmt.Fprintln(os.Stderr, "Display file contents in hex and ASCII.")
 	fmt.Fprintln(os.Stderr)
-	fmt.Fprintln(os.Stderr, "With no FILE, or when FILE is -, read standard input.")
+	fmt.Fprintln(os.Stderr, "With no FILE, or when FILE is -, read standard input. Multiple FILEs are")
+	fmt.Fprintln(os.Stderr, "dumped as one continuous stream, unless -per-file is set.")
 	fmt.Fprintln(os.Stderr)
 	fmt.Fprintln(os.Stderr, "Flags:")
 	flag.PrintDefaults()
 	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "The -n and -s flags accept the unit suffixes K, M, G and T (powers of 1024),")
+	fmt.Fprintln(os.Stderr, "KiB, MiB, GiB and TiB (powers of 1024), and kB, MB, GB and TB (powers of 1000).")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "A format string consists of format units, each of the form")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, `  [iteration_count]/[byte_count] "format"`)
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "where format is a printf-style format. The byte count is the number of bytes")
+	fmt.Fprintf(os.Stderr, "interpreted by each iteration of the format. In addition to the %%d, %%i, %%o,\n")
+	fmt.Fprintf(os.Stderr, "%%u, %%x, %%X, %%e, %%E, %%f, %%g, %%G, %%c and %%s conversions, the following\n")
+	fmt.Fprintln(os.Stderr, "conversions are supported:")
+	fmt.Fprintf(os.Stderr, "  %%_a[dox]  offset of the next byte in decimal, octal or hexadecimal\n")
+	fmt.Fprintf(os.Stderr, "  %%_A[dox]  offset once all input has been processed\n")
+	fmt.Fprintf(os.Stderr, "  %%_c       character, with C escapes for non-printable characters\n")
+	fmt.Fprintf(os.Stderr, "  %%_p       printable character, or '.' for non-printable characters\n")
+	fmt.Fprintf(os.Stderr, "  %%_u       character, with US ASCII names for control characters\n")
+	fmt.Fprintln(os.Stderr)
 	fmt.Fprintln(os.Stderr, "Examples:")
 	fmt.Fprintln(os.Stderr, "  hexdump -n 0x10 f  Output a hex dump of the first 16 bytes of f's contents.")
 	fmt.Fprintln(os.Stderr, "  hexdump -s 4 f  Skip the first 4 bytes and output a hex dump of f's contents.")
+	fmt.Fprintln(os.Stderr, "  hexdump -s -512 f  Output a hex dump of the last 512 bytes of f's contents.")
+	fmt.Fprintln(os.Stderr, "  hexdump -find 0x7f454c46 f  Output the offset of each ELF magic number in f.")
+	fmt.Fprintln(os.Stderr, "  hexdump -diff f g  Output a hex dump of the differences between f and g.")
+	fmt.Fprintf(os.Stderr, `  hexdump -e '4/4 "%%08x " "\n"' f  Output f's contents as 32-bit words, four per line.`+"\n")
 }
 
 func main() {
 	flag.Parse()
-	if flag.NArg() == 0 {
-		// Read from stdin when no FILE has been provided.
-		err := hexdump(StdinFileName)
+	if len(formats) == 0 {
+		formats = formatCanonical
+	}
+	switch flagColor {
+	case "auto", "always", "never":
+	default:
+		log.Fatalf("hexdump: invalid color mode %q; expected auto, always or never", flagColor)
+	}
+	if flagLength < 0 {
+		log.Fatalln("hexdump: invalid length", flagLength)
+	}
+	fss, blocksize, err := parseFormats(formats)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if flagDiff {
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		differ, err := hexdumpDiff(flag.Arg(0), flag.Arg(1), fss, blocksize)
 		if err != nil {
 			log.Fatalln(err)
 		}
+		if differ {
+			os.Exit(1)
+		}
 		return
 	}
 
-	for _, filePath := range flag.Args() {
-		err := hexdump(filePath)
+	filePaths := flag.Args()
+	if len(filePaths) == 0 {
+		// Read from stdin when no FILE has been provided.
+		filePaths = []string{StdinFileName}
+	}
+
+	if flagFind != "" {
+		if flagContext < 0 {
+			log.Fatalln("hexdump: invalid context length", flagContext)
+		}
+		pattern, err := parsePattern(flagFind)
 		if err != nil {
 			log.Fatalln(err)
 		}
-	}
-}
-
-// StdinFileName is a reserved file name used for standard input.
-const StdinFileName = "-"
-
-// hexdump writes a hex dump of the provided file or standard input (when the
-// provided file path is "-") to standard output. The format of the dump matches
-// the output of `hexdump -C` on the command line.
-func hexdump(filePath string) (err error) {
-	// Open input file.
-	var fr *os.File
-	if filePath == StdinFileName {
-		fr = os.Stdin
-	} else {
-		fr, err = os.Open(filePath)
+		found, err := hexdumpFind(filePaths, pattern, flagContext, fss, blocksize)
 		if err != nil {
-			return err
+			log.Fatalln(err)
 		}
-		defer fr.Close()
+		if !found {
+			os.Exit(1)
+		}
+		return
 	}
 
-	// Ignore directories.
-	fi, err := fr.Stat()
-	if err != nil {
-		return err
-	}
-	if fi.IsDir() {
-		return nil
+	if !flagPerFile {
+		err := hexdumpStream(filePaths, fss, blocksize)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		return
 	}
-
-	if flagOffset != 0 {
-		// Skip x bytes if "-s" flag is used.
-		_, err = fr.Seek(flagOffset, os.SEEK_SET)
+	for _, filePath := range filePaths {
+		err := hexdump(filePath, fss, blocksize)
 		if err != nil {
-			return err
+			log.Fatalln(err)
 		}
 	}
+}
+
+// StdinFileName is a reserved file name used for standard input.
+const StdinFileName = "-"
+
+// hexdumpStream writes a hex dump of the concatenation of the provided files or
+// standard input (when a file path is "-") to standard output, using the
+// provided format strings and block size. The "-s" and "-n" flags apply to the
+// concatenated stream.
+func hexdumpStream(filePaths []string, fss []*formatString, blocksize int) (err error) {
+	return dumpFiles(os.Stdout, filePaths, fss, blocksize)
+}
 
-	// Write hex dump to standard output.
-	w := hex.Dumper(os.Stdout)
+// hexdump writes a hex dump of the provided file or standard input (when the
+// provided file path is "-") to standard output, using the provided format
+// strings and block size. The "-s" and "-n" flags apply to the file.
+func hexdump(filePath string, fss []*formatString, blocksize int) (err error) {
 	if flag.NArg() > 1 {
 		// Output path if more than one input file.
 		fmt.Println("path:", filePath)
 		// Output new line after output from w.Close().
 		defer fmt.Println()
 	}
-	defer w.Close()
+	return dumpFiles(os.Stdout, []string{filePath}, fss, blocksize)
+}
+
+// dumpFiles writes a hex dump of the concatenation of the provided files to w,
+// using the provided format strings and block size. The "-s" and "-n" flags
+// apply to the concatenated stream.
+func dumpFiles(w io.Writer, filePaths []string, fss []*formatString, blocksize int) (err error) {
+	skip := int64(flagOffset)
+	n := int64(-1)
 	if flagLength != 0 {
 		// Interpret only x bytes if "-n" flag is used.
-		_, err = io.CopyN(w, fr, flagLength)
-		if err != nil && err != io.EOF {
-			return err
-		}
-	} else {
-		_, err = io.Copy(w, fr)
+		n = int64(flagLength)
+	}
+
+	if skip < 0 {
+		// Count offset from the end of input.
+		size, ok, err := totalSize(filePaths)
 		if err != nil {
 			return err
 		}
+		if !ok {
+			// The size of unseekable input is unknown; keep the end of input in
+			// memory instead.
+			return dumpTail(w, filePaths, -skip, n, fss, blocksize)
+		}
+		skip += size
+		if skip < 0 {
+			skip = 0
+		}
 	}
 
-	return nil
+	d := newDumper(w, fss, blocksize, skip, !flagVerbose, useColor())
+	skipped, err := copyFiles(d, filePaths, skip, n)
+	if err != nil {
+		return err
+	}
+	if skipped < skip {
+		// The input ended before skip bytes; nothing has been dumped, and the
+		// final address is the end of input.
+		d.addr = skipped
+	}
+
+	// Write dump of the final block.
+	return d.Close()
+}
+
+// dumpTail writes a hex dump of at most n bytes, unless n is negative, of the
+// last size bytes of the concatenation of the provided files to w.
+func dumpTail(w io.Writer, filePaths []string, size, n int64, fss []*formatString, blocksize int) (err error) {
+	tw := &tailWriter{size: size}
+	_, err = copyFiles(tw, filePaths, 0, -1)
+	if err != nil {
+		return err
+	}
+	data := tw.Bytes()
+	d := newDumper(w, fss, blocksize, tw.total-int64(len(data)), !flagVerbose, useColor())
+	if n >= 0 && int64(len(data)) > n {
+		data = data[:n]
+	}
+	_, err = d.Write(data)
+	if err != nil {
+		return err
+	}
+
+	// Write dump of the final block.
+	return d.Close()
 }
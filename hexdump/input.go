@@ -0,0 +1,147 @@
+package main
+
+import "io"
+import "os"
+
+// copyFiles copies the concatenation of the provided files or standard input
+// (when a file path is "-") to w, after skipping skip bytes from the beginning
+// of the concatenated stream. At most n bytes are copied, unless n is negative.
+// It returns the number of bytes skipped, which is less than skip if the input
+// ends first.
+func copyFiles(w io.Writer, filePaths []string, skip, n int64) (skipped int64, err error) {
+	for _, filePath := range filePaths {
+		if n == 0 {
+			break
+		}
+		m, copied, err := copyFile(w, filePath, skip-skipped, n)
+		skipped += m
+		if err != nil {
+			return skipped, err
+		}
+		if n > 0 {
+			n -= copied
+		}
+	}
+	return skipped, nil
+}
+
+// copyFile copies the contents of the provided file or standard input (when the
+// provided file path is "-") to w, after skipping skip bytes from the beginning
+// of the file. At most n bytes are copied, unless n is negative. Directories
+// are ignored. It returns the number of bytes skipped and copied.
+//
+// Bytes of unseekable input, such as pipes, are skipped by reading and
+// discarding them.
+func copyFile(w io.Writer, filePath string, skip, n int64) (skipped, copied int64, err error) {
+	// Open input file.
+	var fr *os.File
+	if filePath == StdinFileName {
+		fr = os.Stdin
+	} else {
+		fr, err = os.Open(filePath)
+		if err != nil {
+			return 0, 0, err
+		}
+		defer fr.Close()
+	}
+
+	// Ignore directories.
+	fi, err := fr.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	if fi.IsDir() {
+		return 0, 0, nil
+	}
+
+	if skip > 0 {
+		// Skip x bytes if "-s" flag is used.
+		if fi.Mode().IsRegular() && skip >= fi.Size() {
+			// Skip the entire file.
+			return fi.Size(), 0, nil
+		}
+		_, err = fr.Seek(skip, io.SeekStart)
+		if err != nil {
+			// Discard bytes of unseekable input.
+			skipped, err = io.CopyN(io.Discard, fr, skip)
+			if err != nil {
+				if err == io.EOF {
+					return skipped, 0, nil
+				}
+				return skipped, 0, err
+			}
+		}
+		skipped = skip
+	}
+
+	if n >= 0 {
+		copied, err = io.CopyN(w, fr, n)
+		if err != nil && err != io.EOF {
+			return skipped, copied, err
+		}
+		return skipped, copied, nil
+	}
+	copied, err = io.Copy(w, fr)
+	return skipped, copied, err
+}
+
+// totalSize returns the total size of the provided files or standard input
+// (when a file path is "-"). The returned ok value is false if the size of any
+// of the files is unknown, such as for pipes. Directories are ignored.
+func totalSize(filePaths []string) (size int64, ok bool, err error) {
+	for _, filePath := range filePaths {
+		var fi os.FileInfo
+		if filePath == StdinFileName {
+			fi, err = os.Stdin.Stat()
+		} else {
+			fi, err = os.Stat(filePath)
+		}
+		if err != nil {
+			return 0, false, err
+		}
+		switch {
+		case fi.IsDir():
+			// Ignore directories.
+		case fi.Mode().IsRegular():
+			size += fi.Size()
+		default:
+			return 0, false, nil
+		}
+	}
+	return size, true, nil
+}
+
+// A tailWriter keeps the last size bytes written to it.
+type tailWriter struct {
+	// Number of bytes to keep.
+	size int64
+	// Total number of bytes written.
+	total int64
+	// Buffered data, of which the last size bytes are kept.
+	buf []byte
+}
+
+// Write writes p to the tail writer, discarding all but the last size bytes
+// written.
+func (tw *tailWriter) Write(p []byte) (n int, err error) {
+	tw.total += int64(len(p))
+	if int64(len(p)) >= tw.size {
+		tw.buf = append(tw.buf[:0], p[int64(len(p))-tw.size:]...)
+		return len(p), nil
+	}
+	if int64(len(tw.buf)+len(p)) > 2*tw.size {
+		// Move the kept bytes to the front of the buffer.
+		keep := tw.size - int64(len(p))
+		tw.buf = append(tw.buf[:0], tw.buf[int64(len(tw.buf))-keep:]...)
+	}
+	tw.buf = append(tw.buf, p...)
+	return len(p), nil
+}
+
+// Bytes returns the last size bytes written to the tail writer.
+func (tw *tailWriter) Bytes() []byte {
+	if int64(len(tw.buf)) > tw.size {
+		return tw.buf[int64(len(tw.buf))-tw.size:]
+	}
+	return tw.buf
+}
@@ -0,0 +1,565 @@
+package main
+
+import "errors"
+import "fmt"
+import "io"
+import "math"
+import "strconv"
+import "strings"
+import "unicode/utf8"
+
+// printf writes the arguments formatted according to format to w. The format
+// is reused as long as there are arguments left to consume.
+//
+// Invalid numeric arguments do not stop the output; they are converted as far
+// as possible and reported in the returned error once all output has been
+// written.
+func printf(w io.Writer, format string, args []string) (err error) {
+	f := &formatter{args: args}
+	for {
+		f.used = false
+		stop, err := f.format(format)
+		if err != nil {
+			f.errs = append(f.errs, err)
+			break
+		}
+		if stop || len(f.args) == 0 || !f.used {
+			break
+		}
+	}
+	_, err = io.WriteString(w, f.buf.String())
+	if err != nil {
+		f.errs = append(f.errs, err)
+	}
+	return errors.Join(f.errs...)
+}
+
+// A formatter formats arguments according to a printf format string.
+type formatter struct {
+	// Formatted output.
+	buf strings.Builder
+	// Arguments not yet consumed.
+	args []string
+	// used is true if an argument was consumed during the current pass over
+	// the format string.
+	used bool
+	// Conversion errors.
+	errs []error
+}
+
+// nextArg consumes and returns the next argument. The empty string is returned
+// if all arguments have been consumed.
+func (f *formatter) nextArg() string {
+	f.used = true
+	if len(f.args) == 0 {
+		return ""
+	}
+	arg := f.args[0]
+	f.args = f.args[1:]
+	return arg
+}
+
+// format makes one pass over the format string. The returned stop value is true
+// if a "\c" escape was encountered, in which case no further output should be
+// produced.
+func (f *formatter) format(format string) (stop bool, err error) {
+	for i := 0; i < len(format); i++ {
+		switch format[i] {
+		case '\\':
+			s, n, stop := unescapeAt(format[i+1:], false)
+			f.buf.WriteString(s)
+			if stop {
+				return true, nil
+			}
+			i += n
+		case '%':
+			n, stop, err := f.conv(format[i+1:])
+			if err != nil {
+				return false, err
+			}
+			if stop {
+				return true, nil
+			}
+			i += n
+		default:
+			f.buf.WriteByte(format[i])
+		}
+	}
+	return false, nil
+}
+
+// conv formats the next argument according to the conversion specification at
+// the start of spec, which directly follows a '%' character. It returns the
+// length of the conversion specification. The returned stop value is true if
+// the argument of a %b conversion contained a "\c" escape.
+func (f *formatter) conv(spec string) (n int, stop bool, err error) {
+	if strings.HasPrefix(spec, "%") {
+		f.buf.WriteByte('%')
+		return 1, false, nil
+	}
+
+	// Parse flags.
+	i := 0
+	for i < len(spec) && strings.IndexByte("-+ #0", spec[i]) != -1 {
+		i++
+	}
+	flags := spec[:i]
+
+	// Parse field width.
+	width := ""
+	if i < len(spec) && spec[i] == '*' {
+		w := f.intArg(f.nextArg())
+		if w < 0 {
+			// A negative field width is taken as a '-' flag followed by a
+			// positive field width.
+			flags += "-"
+			w = -w
+		}
+		width = strconv.FormatInt(w, 10)
+		i++
+	} else {
+		start := i
+		for i < len(spec) && isDigit(spec[i]) {
+			i++
+		}
+		width = spec[start:i]
+	}
+
+	// Parse precision.
+	prec := ""
+	hasPrec := false
+	if i < len(spec) && spec[i] == '.' {
+		hasPrec = true
+		i++
+		if i < len(spec) && spec[i] == '*' {
+			p := f.intArg(f.nextArg())
+			if p < 0 {
+				// A negative precision is taken as if the precision were
+				// omitted.
+				hasPrec = false
+			} else {
+				prec = strconv.FormatInt(p, 10)
+			}
+			i++
+		} else {
+			start := i
+			for i < len(spec) && isDigit(spec[i]) {
+				i++
+			}
+			prec = spec[start:i]
+			if prec == "" {
+				prec = "0"
+			}
+		}
+	}
+
+	// Skip length modifiers, which have no meaning for string arguments.
+	for i < len(spec) && strings.IndexByte("hlLjzt", spec[i]) != -1 {
+		i++
+	}
+
+	if i >= len(spec) {
+		return 0, false, fmt.Errorf("%%%s: missing format character", spec)
+	}
+	verb, size := utf8.DecodeRuneInString(spec[i:])
+	n = i + size
+
+	// goSpec returns the equivalent Go format specification for the given verb.
+	goSpec := func(flags string, verb rune) string {
+		s := "%" + flags + width
+		if hasPrec {
+			s += "." + prec
+		}
+		return s + string(verb)
+	}
+
+	if strings.ContainsRune("csbq", verb) {
+		// The '0' flag only has an effect on numeric conversions.
+		flags = strings.Replace(flags, "0", "", -1)
+	}
+
+	switch verb {
+	case 'd', 'i':
+		v := f.intArg(f.nextArg())
+		fmt.Fprintf(&f.buf, goSpec(flags, 'd'), v)
+	case 'u', 'o', 'x', 'X':
+		v := f.uintArg(f.nextArg())
+		if v == 0 && verb != 'o' {
+			// The alternate form only has an effect on non-zero values.
+			flags = strings.Replace(flags, "#", "", -1)
+		}
+		if verb == 'u' {
+			verb = 'd'
+		}
+		fmt.Fprintf(&f.buf, goSpec(flags, verb), v)
+	case 'f', 'F', 'e', 'E', 'g', 'G':
+		v := f.floatArg(f.nextArg())
+		if !hasPrec {
+			// Go uses the smallest number of digits necessary for %g, whereas
+			// C uses a default precision of 6 for all floating-point
+			// conversions.
+			hasPrec = true
+			prec = "6"
+		}
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			// Go formats infinities and NaN as "+Inf", "-Inf" and "NaN",
+			// whereas C uses "inf", "-inf" and "nan", in upper case for
+			// upper case conversions, and pads them with spaces.
+			s := "inf"
+			switch {
+			case math.IsNaN(v):
+				s = "nan"
+			case v < 0:
+				s = "-inf"
+			}
+			if s[0] != '-' {
+				if strings.Contains(flags, "+") {
+					s = "+" + s
+				} else if strings.Contains(flags, " ") {
+					s = " " + s
+				}
+			}
+			if strings.ContainsRune("FEG", verb) {
+				s = strings.ToUpper(s)
+			}
+			left := ""
+			if strings.Contains(flags, "-") {
+				left = "-"
+			}
+			hasPrec = false
+			fmt.Fprintf(&f.buf, goSpec(left, 's'), s)
+			break
+		}
+		fmt.Fprintf(&f.buf, goSpec(flags, verb), v)
+	case 'c':
+		arg := f.nextArg()
+		if len(arg) > 0 {
+			_, size := utf8.DecodeRuneInString(arg)
+			arg = arg[:size]
+		}
+		hasPrec = false
+		fmt.Fprintf(&f.buf, goSpec(flags, 's'), arg)
+	case 's':
+		fmt.Fprintf(&f.buf, goSpec(flags, 's'), f.nextArg())
+	case 'b':
+		s, stop := unescape(f.nextArg(), true)
+		fmt.Fprintf(&f.buf, goSpec(flags, 's'), s)
+		if stop {
+			return n, true, nil
+		}
+	case 'q':
+		hasPrec = false
+		fmt.Fprintf(&f.buf, goSpec(flags, 's'), shellQuote(f.nextArg()))
+	default:
+		return 0, false, fmt.Errorf("%%%s: invalid conversion specification", spec[:n])
+	}
+	return n, false, nil
+}
+
+// intArg parses arg as a signed integer. Invalid arguments are recorded as
+// conversion errors, and the longest valid prefix of arg is used as value.
+func (f *formatter) intArg(arg string) int64 {
+	if v, ok := charConst(arg); ok {
+		return v
+	}
+	s, neg, digits, base, valid := splitInt(arg)
+	if !valid {
+		f.errs = append(f.errs, fmt.Errorf("%q: expected a numeric value", arg))
+	}
+	u, err := strconv.ParseUint(digits, base, 64)
+	if err != nil && digits != "" {
+		f.errs = append(f.errs, fmt.Errorf("%q: %v", s, errors.Unwrap(err)))
+	}
+	if neg {
+		if u > 1<<63 {
+			if err == nil {
+				f.errs = append(f.errs, fmt.Errorf("%q: %v", s, strconv.ErrRange))
+			}
+			u = 1 << 63
+		}
+		return -int64(u)
+	}
+	if u > 1<<63-1 {
+		if err == nil {
+			f.errs = append(f.errs, fmt.Errorf("%q: %v", s, strconv.ErrRange))
+		}
+		u = 1<<63 - 1
+	}
+	return int64(u)
+}
+
+// uintArg parses arg as an unsigned integer. Negative values are converted to
+// their two's complement representation, as with C's unsigned conversions.
+// Invalid arguments are recorded as conversion errors, and the longest valid
+// prefix of arg is used as value.
+func (f *formatter) uintArg(arg string) uint64 {
+	if v, ok := charConst(arg); ok {
+		return uint64(v)
+	}
+	s, neg, digits, base, valid := splitInt(arg)
+	if !valid {
+		f.errs = append(f.errs, fmt.Errorf("%q: expected a numeric value", arg))
+	}
+	u, err := strconv.ParseUint(digits, base, 64)
+	if err != nil && digits != "" {
+		f.errs = append(f.errs, fmt.Errorf("%q: %v", s, errors.Unwrap(err)))
+	}
+	if neg {
+		return -u
+	}
+	return u
+}
+
+// floatArg parses arg as a floating-point number. Invalid arguments are
+// recorded as conversion errors and yield zero.
+func (f *formatter) floatArg(arg string) float64 {
+	if v, ok := charConst(arg); ok {
+		return float64(v)
+	}
+	s := strings.TrimLeft(arg, " \t\n")
+	if s == "" {
+		if arg != "" {
+			f.errs = append(f.errs, fmt.Errorf("%q: expected a numeric value", arg))
+		}
+		return 0
+	}
+	if strings.ContainsRune(s, '_') {
+		// Go accepts underscores in number literals, C does not.
+		f.errs = append(f.errs, fmt.Errorf("%q: expected a numeric value", arg))
+		return 0
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		if errors.Is(err, strconv.ErrRange) {
+			f.errs = append(f.errs, fmt.Errorf("%q: %v", arg, strconv.ErrRange))
+			return v
+		}
+		f.errs = append(f.errs, fmt.Errorf("%q: expected a numeric value", arg))
+		return 0
+	}
+	return v
+}
+
+// charConst returns the character code of arg if it is a character constant,
+// i.e. a leading single or double quote followed by a character.
+func charConst(arg string) (v int64, ok bool) {
+	if len(arg) == 0 || (arg[0] != '\'' && arg[0] != '"') {
+		return 0, false
+	}
+	r, _ := utf8.DecodeRuneInString(arg[1:])
+	if r == utf8.RuneError {
+		if len(arg) < 2 {
+			return 0, true
+		}
+		return int64(arg[1]), true
+	}
+	return int64(r), true
+}
+
+// splitInt splits the integer argument arg, as accepted by C's strtol, into its
+// sign and digits. Leading whitespace is ignored, a "0x" prefix denotes base 16
+// and a leading "0" denotes base 8. The returned digits hold the longest valid
+// prefix of the number, s holds the argument without leading whitespace, and
+// valid is false if arg contained trailing characters or no digits at all. An
+// empty argument is valid and yields no digits.
+func splitInt(arg string) (s string, neg bool, digits string, base int, valid bool) {
+	s = strings.TrimLeft(arg, " \t\n")
+	if arg == "" {
+		return s, false, "", 10, true
+	}
+	rest := s
+	if strings.HasPrefix(rest, "-") || strings.HasPrefix(rest, "+") {
+		neg = rest[0] == '-'
+		rest = rest[1:]
+	}
+	base = 10
+	switch {
+	case len(rest) > 2 && rest[0] == '0' && (rest[1] == 'x' || rest[1] == 'X') && digitVal(rest[2]) < 16:
+		base = 16
+		rest = rest[2:]
+	case strings.HasPrefix(rest, "0"):
+		base = 8
+	}
+	i := 0
+	for i < len(rest) && digitVal(rest[i]) < base {
+		i++
+	}
+	digits = rest[:i]
+	return s, neg, digits, base, i > 0 && i == len(rest)
+}
+
+// unescape returns s with its backslash escapes interpreted. The returned stop
+// value is true if s contains a "\c" escape, in which case the returned string
+// holds the output up to but not including the escape.
+//
+// When octal0 is set, octal escapes take the form \0NNN as with %b and echo;
+// otherwise they take the form \NNN as in format strings.
+func unescape(s string, octal0 bool) (out string, stop bool) {
+	buf := new(strings.Builder)
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			buf.WriteByte(s[i])
+			continue
+		}
+		t, n, stop := unescapeAt(s[i+1:], octal0)
+		buf.WriteString(t)
+		if stop {
+			return buf.String(), true
+		}
+		i += n
+	}
+	return buf.String(), false
+}
+
+// unescapeAt interprets the backslash escape at the start of s, which directly
+// follows a backslash. It returns the interpreted output and the number of
+// bytes of s consumed. The returned stop value is true for the "\c" escape.
+func unescapeAt(s string, octal0 bool) (out string, n int, stop bool) {
+	if len(s) == 0 {
+		return `\`, 0, false
+	}
+	switch c := s[0]; c {
+	case '\\':
+		return `\`, 1, false
+	case '"':
+		return `"`, 1, false
+	case 'a':
+		return "\a", 1, false
+	case 'b':
+		return "\b", 1, false
+	case 'c':
+		return "", 1, true
+	case 'e':
+		return "\x1B", 1, false
+	case 'f':
+		return "\f", 1, false
+	case 'n':
+		return "\n", 1, false
+	case 'r':
+		return "\r", 1, false
+	case 't':
+		return "\t", 1, false
+	case 'v':
+		return "\v", 1, false
+	case 'x':
+		// \xHH, where HH is one or two hexadecimal digits.
+		v, m := parseDigits(s[1:], 16, 2)
+		if m == 0 {
+			return `\x`, 1, false
+		}
+		return string([]byte{byte(v)}), 1 + m, false
+	case 'u', 'U':
+		// \uHHHH and \UHHHHHHHH Unicode characters.
+		want := 4
+		if c == 'U' {
+			want = 8
+		}
+		v, m := parseDigits(s[1:], 16, want)
+		if m != want || !utf8.ValidRune(rune(v)) {
+			return `\` + string(c), 1, false
+		}
+		return string(rune(v)), 1 + m, false
+	}
+	if octal0 {
+		if s[0] == '0' {
+			// \0NNN, where NNN is zero to three octal digits.
+			v, m := parseDigits(s[1:], 8, 3)
+			return string([]byte{byte(v)}), 1 + m, false
+		}
+	} else if digitVal(s[0]) < 8 {
+		// \NNN, where NNN is one to three octal digits.
+		v, m := parseDigits(s, 8, 3)
+		return string([]byte{byte(v)}), m, false
+	}
+	// Unknown escape; output verbatim.
+	return `\` + s[:1], 1, false
+}
+
+// shellQuote quotes s so that it can be reused as shell input.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	printable := true
+	for _, r := range s {
+		switch {
+		case r < ' ' || r == 0x7F:
+			printable = false
+			safe = false
+		case !(isDigit(byte(r)) || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || strings.ContainsRune("@%_+=:,./-", r) || r >= utf8.RuneSelf):
+			safe = false
+		}
+	}
+	if safe {
+		return s
+	}
+	if printable {
+		return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+	}
+	// Use ANSI-C quoting for strings containing control characters.
+	buf := new(strings.Builder)
+	buf.WriteString("$'")
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\'', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\a':
+			buf.WriteString(`\a`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\v':
+			buf.WriteString(`\v`)
+		default:
+			if c < ' ' || c == 0x7F {
+				fmt.Fprintf(buf, `\%03o`, c)
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	}
+	buf.WriteString("'")
+	return buf.String()
+}
+
+// parseDigits parses at most max leading digits of s in the given base. It
+// returns the parsed value and the number of digits consumed.
+func parseDigits(s string, base, max int) (v, n int) {
+	for n < max && n < len(s) {
+		d := digitVal(s[n])
+		if d >= base {
+			break
+		}
+		v = v*base + d
+		n++
+	}
+	return v, n
+}
+
+// isDigit reports whether c is a decimal digit.
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// digitVal returns the numeric value of the hexadecimal digit c, or 16 if c is
+// not a hexadecimal digit.
+func digitVal(c byte) int {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c - '0')
+	case 'a' <= c && c <= 'f':
+		return int(c-'a') + 10
+	case 'A' <= c && c <= 'F':
+		return int(c-'A') + 10
+	}
+	return 16
+}
@@ -0,0 +1,146 @@
+package main
+
+import "strings"
+import "testing"
+
+func TestPrintf(t *testing.T) {
+	golden := []struct {
+		format string
+		args   []string
+		want   string
+	}{
+		// Plain text and escapes.
+		{format: `hello\n`, want: "hello\n"},
+		{format: `100%%`, want: "100%"},
+		{format: `a\tb\\c`, want: "a\tb\\c"},
+		{format: `\101\0102`, want: "A\b2"},
+		{format: `\x41\x4a\xg`, want: "AJ\\xg"},
+		{format: `é\U0001F600`, want: "é😀"},
+		{format: `a\qb`, want: `a\qb`},
+		{format: `a\cb`, want: "a"},
+		// Format reuse.
+		{format: `%s=%d\n`, args: []string{"a", "1", "b", "2"}, want: "a=1\nb=2\n"},
+		{format: `%s,`, args: []string{"a", "b", "c"}, want: "a,b,c,"},
+		{format: `%s %s\n`, args: []string{"a", "b", "c"}, want: "a b\nc \n"},
+		{format: `%d %d|`, args: []string{"1"}, want: "1 0|"},
+		{format: `x\n`, args: []string{"a", "b"}, want: "x\n"},
+		{format: `%s\c%s`, args: []string{"a", "b", "c"}, want: "a"},
+		// Width and precision.
+		{format: `[%5s]`, args: []string{"ab"}, want: "[   ab]"},
+		{format: `[%-5s]`, args: []string{"ab"}, want: "[ab   ]"},
+		{format: `[%.1s]`, args: []string{"ab"}, want: "[a]"},
+		{format: `[%*d]`, args: []string{"4", "7"}, want: "[   7]"},
+		{format: `[%*d]`, args: []string{"-4", "7"}, want: "[7   ]"},
+		{format: `[%.*f]`, args: []string{"2", "3.14159"}, want: "[3.14]"},
+		{format: `[%.*f]`, args: []string{"-1", "3.5"}, want: "[3.500000]"},
+		{format: `[%08.3f]`, args: []string{"3.14159"}, want: "[0003.142]"},
+		{format: `[%.f]`, args: []string{"2.5"}, want: "[2]"},
+		{format: `[%+d|% d]`, args: []string{"5", "5"}, want: "[+5| 5]"},
+		{format: `[%.3d]`, args: []string{"7"}, want: "[007]"},
+		// Numeric conversions.
+		{format: `%d %i`, args: []string{"010", "0x1f"}, want: "8 31"},
+		{format: `%u`, args: []string{"-1"}, want: "18446744073709551615"},
+		{format: `%o %x %X`, args: []string{"8", "255", "255"}, want: "10 ff FF"},
+		{format: `%#o %#x %#x`, args: []string{"8", "255", "0"}, want: "010 0xff 0"},
+		{format: `%d %d`, args: []string{"'A", `"é`}, want: "65 233"},
+		{format: `%g %e`, args: []string{"0.5", "1234.5"}, want: "0.5 1.234500e+03"},
+		{format: `%ld %hd`, args: []string{"3", "4"}, want: "3 4"},
+		{format: `%f %f %f`, args: []string{"inf", "-inf", "nan"}, want: "inf -inf nan"},
+		{format: `%F %E %G`, args: []string{"inf", "-Infinity", "NaN"}, want: "INF -INF NAN"},
+		{format: `[%05f|%+e|%-5g]`, args: []string{"inf", "inf", "nan"}, want: "[  inf|+inf|nan  ]"},
+		// Characters and strings.
+		{format: `%c%c`, args: []string{"hello", "é!"}, want: "hé"},
+		{format: `[%c]`, args: []string{""}, want: "[]"},
+		{format: `[%05s|%03c]`, args: []string{"ab", "x"}, want: "[   ab|  x]"},
+		{format: `[%05b|%06q]`, args: []string{`a\n`, "a b"}, want: "[   a\n| 'a b']"},
+		// %b conversions.
+		{format: `%b`, args: []string{`a\tb\n`}, want: "a\tb\n"},
+		{format: `%b`, args: []string{`\0101\101`}, want: `A\101`},
+		{format: `[%5b]`, args: []string{`a\n`}, want: "[   a\n]"},
+		{format: `%b|%s`, args: []string{`a\cb`, "c"}, want: "a"},
+		// %q conversions.
+		{format: `%q`, args: []string{"abc"}, want: "abc"},
+		{format: `%q`, args: []string{""}, want: "''"},
+		{format: `%q`, args: []string{"a b"}, want: "'a b'"},
+		{format: `%q`, args: []string{"it's"}, want: `'it'\''s'`},
+		{format: `%q`, args: []string{"a\tb\x01'"}, want: `$'a\tb\001\''`},
+		{format: `[%6q]`, args: []string{"a b"}, want: "[ 'a b']"},
+	}
+	for _, g := range golden {
+		buf := new(strings.Builder)
+		err := printf(buf, g.format, g.args)
+		if err != nil {
+			t.Errorf("printf(%q, %q): unexpected error; %v", g.format, g.args, err)
+			continue
+		}
+		if got := buf.String(); got != g.want {
+			t.Errorf("printf(%q, %q): expected %q, got %q", g.format, g.args, g.want, got)
+		}
+	}
+}
+
+func TestPrintfError(t *testing.T) {
+	golden := []struct {
+		format string
+		args   []string
+		// Output written despite the error.
+		want string
+		// Substring of the error message.
+		err string
+	}{
+		{format: `%d|`, args: []string{"abc"}, want: "0|", err: `"abc": expected a numeric value`},
+		{format: `%d|`, args: []string{"12abc"}, want: "12|", err: `"12abc": expected a numeric value`},
+		{format: `%d|`, args: []string{"099"}, want: "0|", err: `"099": expected a numeric value`},
+		{format: `%d|`, args: []string{"9223372036854775808"}, want: "9223372036854775807|", err: "value out of range"},
+		{format: `%d|`, args: []string{"-9223372036854775809"}, want: "-9223372036854775808|", err: "value out of range"},
+		{format: `%u|`, args: []string{"18446744073709551616"}, want: "18446744073709551615|", err: "value out of range"},
+		{format: `%x|`, args: []string{"zz"}, want: "0|", err: `"zz": expected a numeric value`},
+		{format: `%f|`, args: []string{"1.5x"}, want: "0.000000|", err: `"1.5x": expected a numeric value`},
+		{format: `%f|`, args: []string{"1_0"}, want: "0.000000|", err: `"1_0": expected a numeric value`},
+		{format: `%d %d|`, args: []string{"x", "2"}, want: "0 2|", err: `"x": expected a numeric value`},
+		{format: `a%`, want: "a", err: "missing format character"},
+		{format: `a%5`, want: "a", err: "missing format character"},
+		{format: `a%yb`, want: "a", err: "%y: invalid conversion specification"},
+	}
+	for _, g := range golden {
+		buf := new(strings.Builder)
+		err := printf(buf, g.format, g.args)
+		if err == nil {
+			t.Errorf("printf(%q, %q): expected error containing %q, got nil", g.format, g.args, g.err)
+		} else if !strings.Contains(err.Error(), g.err) {
+			t.Errorf("printf(%q, %q): expected error containing %q, got %q", g.format, g.args, g.err, err)
+		}
+		if got := buf.String(); got != g.want {
+			t.Errorf("printf(%q, %q): expected output %q, got %q", g.format, g.args, g.want, got)
+		}
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	golden := []struct {
+		in     string
+		octal0 bool
+		want   string
+		stop   bool
+	}{
+		{in: `plain`, want: "plain"},
+		{in: `\\\a\b\e\f\n\r\t\v\"`, want: "\\\a\b\x1B\f\n\r\t\v\""},
+		{in: `\101\60\7`, want: "A0\a"},
+		{in: `\1011`, want: "A1"},
+		{in: `\101`, octal0: true, want: `\101`},
+		{in: `\0101\0\00`, octal0: true, want: "A\x00\x00"},
+		{in: `\01011`, octal0: true, want: "A1"},
+		{in: `\x41\x4A1\x`, want: "AJ1\\x"},
+		{in: `é\u00e`, want: "é\\u00e"},
+		{in: `\U0001F600\UD800`, want: "😀\\UD800"},
+		{in: `\uD800`, want: `\uD800`},
+		{in: `\z\`, want: `\z\`},
+		{in: `ab\cde`, want: "ab", stop: true},
+	}
+	for _, g := range golden {
+		got, stop := unescape(g.in, g.octal0)
+		if got != g.want || stop != g.stop {
+			t.Errorf("unescape(%q, %v): expected %q, %v, got %q, %v", g.in, g.octal0, g.want, g.stop, got, stop)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import "flag"
+import "fmt"
+import "log"
+import "os"
+
+func init() {
+	flag.Usage = usage
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: printf FORMAT [ARGUMENT]...")
+	fmt.Fprintln(os.Stderr, "Print ARGUMENT(s) according to FORMAT.")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "FORMAT is reused as necessary to consume all ARGUMENT(s). Missing arguments")
+	fmt.Fprintln(os.Stderr, "are treated as an empty string or zero.")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Conversions:")
+	fmt.Fprintf(os.Stderr, "  %%d, %%i        signed decimal integer\n")
+	fmt.Fprintf(os.Stderr, "  %%u            unsigned decimal integer\n")
+	fmt.Fprintf(os.Stderr, "  %%o            unsigned octal integer\n")
+	fmt.Fprintf(os.Stderr, "  %%x, %%X        unsigned hexadecimal integer\n")
+	fmt.Fprintf(os.Stderr, "  %%f, %%F        floating-point number in decimal notation\n")
+	fmt.Fprintf(os.Stderr, "  %%e, %%E        floating-point number in scientific notation\n")
+	fmt.Fprintf(os.Stderr, "  %%g, %%G        floating-point number in %%f or %%e notation\n")
+	fmt.Fprintf(os.Stderr, "  %%c            first character of ARGUMENT\n")
+	fmt.Fprintf(os.Stderr, "  %%s            ARGUMENT as a string\n")
+	fmt.Fprintf(os.Stderr, "  %%b            ARGUMENT as a string with backslash escapes interpreted\n")
+	fmt.Fprintf(os.Stderr, "  %%q            ARGUMENT quoted for reuse as shell input\n")
+	fmt.Fprintf(os.Stderr, "  %%%%            a single %%\n")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Examples:")
+	fmt.Fprintf(os.Stderr, `  printf '%%s=%%d\n' a 1 b 2  Output "a=1" and "b=2" on separate lines.`+"\n")
+	fmt.Fprintf(os.Stderr, `  printf '%%08.3f\n' 3.14159  Output "0003.142".`+"\n")
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	err := printf(os.Stdout, flag.Arg(0), flag.Args()[1:])
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
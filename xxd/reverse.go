@@ -0,0 +1,148 @@
+package main
+
+import "bufio"
+import "fmt"
+import "io"
+import "os"
+import "strconv"
+import "strings"
+
+// reverse converts the hex dump read from r back to binary and writes it to
+// f. In the normal mode, the data of each line is written at the offset of the
+// line, which allows hex dumps to patch existing files; in the plain mode, the
+// data is written sequentially. The "-s" flag is added to all offsets.
+func reverse(f *os.File, r io.Reader) (err error) {
+	pw := newPatchWriter(f)
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	off := flagSeek
+	for lineNum := 1; s.Scan(); lineNum++ {
+		line := s.Text()
+		if flagPlain {
+			data := parseHex(line, true)
+			err = pw.WriteAt(data, off)
+			if err != nil {
+				return err
+			}
+			off += int64(len(data))
+			continue
+		}
+
+		// Parse offset.
+		pos := strings.IndexByte(line, ':')
+		if pos == -1 {
+			// Ignore lines without offset.
+			continue
+		}
+		addr, err := strconv.ParseInt(strings.TrimSpace(line[:pos]), 16, 64)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid offset %q", lineNum, line[:pos])
+		}
+		off = addr + flagSeek
+		if off < 0 {
+			return fmt.Errorf("line %d: negative offset %d", lineNum, off)
+		}
+
+		// Parse data.
+		data := parseHex(line[pos+1:], false)
+		err = pw.WriteAt(data, off)
+		if err != nil {
+			return err
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	return pw.Flush()
+}
+
+// parseHex parses the hex digits of s and returns the decoded bytes. In plain
+// mode, all characters other than hex digits are ignored. Otherwise, single
+// spaces between hex digits are ignored, and parsing stops at the first other
+// character or at two consecutive spaces, which separate the hex and ASCII
+// columns of the normal output mode. A trailing unpaired hex digit is ignored.
+func parseHex(s string, plain bool) (data []byte) {
+	var c byte
+	nibbles := 0
+	for i := 0; i < len(s); i++ {
+		v := hexVal(s[i])
+		if v < 0 {
+			if plain {
+				continue
+			}
+			if s[i] == ' ' && !strings.HasPrefix(s[i+1:], " ") {
+				continue
+			}
+			break
+		}
+		c = c<<4 | byte(v)
+		nibbles++
+		if nibbles%2 == 0 {
+			data = append(data, c)
+			c = 0
+		}
+	}
+	return data
+}
+
+// hexVal returns the value of the hex digit c, or -1 if c is not a hex digit.
+func hexVal(c byte) int {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c - '0')
+	case 'a' <= c && c <= 'f':
+		return int(c-'a') + 10
+	case 'A' <= c && c <= 'F':
+		return int(c-'A') + 10
+	}
+	return -1
+}
+
+// A patchWriter writes data at given offsets of a file. If the file is not
+// seekable, such as a pipe, the offsets may only move forwards and any gap is
+// filled with zero bytes.
+type patchWriter struct {
+	// Output file.
+	f *os.File
+	// Buffered writer of unseekable output files.
+	bw *bufio.Writer
+	// Offset of the next byte written to unseekable output files.
+	pos int64
+}
+
+// newPatchWriter returns a new patch writer for the provided output file.
+func newPatchWriter(f *os.File) *patchWriter {
+	pw := &patchWriter{f: f}
+	if _, err := f.Seek(0, io.SeekCurrent); err != nil {
+		pw.bw = bufio.NewWriter(f)
+	}
+	return pw
+}
+
+// WriteAt writes p at offset off of the output file.
+func (pw *patchWriter) WriteAt(p []byte, off int64) (err error) {
+	if pw.bw == nil {
+		_, err = pw.f.WriteAt(p, off)
+		return err
+	}
+	if off < pw.pos {
+		return fmt.Errorf("cannot seek backwards to offset 0x%x in unseekable output", off)
+	}
+	for ; pw.pos < off; pw.pos++ {
+		err = pw.bw.WriteByte(0)
+		if err != nil {
+			return err
+		}
+	}
+	n, err := pw.bw.Write(p)
+	pw.pos += int64(n)
+	return err
+}
+
+// Flush writes any buffered data to the output file.
+func (pw *patchWriter) Flush() error {
+	if pw.bw == nil {
+		return nil
+	}
+	return pw.bw.Flush()
+}
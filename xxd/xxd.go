@@ -0,0 +1,331 @@
+package main
+
+import "bufio"
+import "flag"
+import "fmt"
+import "io"
+import "log"
+import "os"
+import "path/filepath"
+import "strings"
+
+// flagCols is the number of bytes per output line. 0 corresponds to the default
+// of the output mode.
+var flagCols int
+
+// flagGroup is the number of bytes per group in the normal output mode. 0
+// disables grouping.
+var flagGroup int
+
+// When flagPlain is true, output a plain hex dump without offsets or ASCII.
+var flagPlain bool
+
+// When flagInclude is true, output a C include file.
+var flagInclude bool
+
+// When flagReverse is true, convert a hex dump back to binary.
+var flagReverse bool
+
+// When flagUpper is true, use upper case hex letters.
+var flagUpper bool
+
+// flagSeek is the number of bytes to skip from the beginning of the input, or
+// if negative, the number of bytes to interpret from the end of the input. In
+// reverse mode, it is added to the offsets of the hex dump.
+var flagSeek int64
+
+// flagLength is the number of bytes which should be interpreted. 0 corresponds
+// to the entire input.
+var flagLength int64
+
+func init() {
+	flag.IntVar(&flagCols, "c", 0, "Output x bytes per line (default 16; 30 with -p; 12 with -i).")
+	flag.IntVar(&flagGroup, "g", 2, "Separate the output of every x bytes by a space.")
+	flag.BoolVar(&flagPlain, "p", false, "Output in plain hex dump style.")
+	flag.BoolVar(&flagInclude, "i", false, "Output in C include file style.")
+	flag.BoolVar(&flagReverse, "r", false, "Convert a hex dump into binary.")
+	flag.BoolVar(&flagUpper, "u", false, "Use upper case hex letters.")
+	flag.Int64Var(&flagSeek, "s", 0, "Skip x bytes from the beginning of the input, or start x bytes before the end if negative; added to offsets with -r.")
+	flag.Int64Var(&flagLength, "l", 0, "Interpret only x bytes of input.")
+	flag.Usage = usage
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: xxd [OPTION]... [INFILE [OUTFILE]]")
+	fmt.Fprintln(os.Stderr, "Make a hex dump of INFILE, or convert a hex dump back to binary.")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "With no INFILE, or when INFILE is -, read standard input. With no OUTFILE, or")
+	fmt.Fprintln(os.Stderr, "when OUTFILE is -, write to standard output.")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Flags:")
+	flag.PrintDefaults()
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Examples:")
+	fmt.Fprintln(os.Stderr, "  xxd f        Output a hex dump of f's contents.")
+	fmt.Fprintln(os.Stderr, "  xxd -i f     Output f's contents as a C array.")
+	fmt.Fprintln(os.Stderr, "  xxd -r d f   Patch f with the contents of the hex dump d.")
+}
+
+// StdinFileName is a reserved file name used for standard input.
+const StdinFileName = "-"
+
+// StdoutFileName is a reserved file name used for standard output.
+const StdoutFileName = "-"
+
+func main() {
+	flag.Parse()
+	inPath, outPath := StdinFileName, StdoutFileName
+	switch flag.NArg() {
+	case 0:
+	case 1:
+		inPath = flag.Arg(0)
+	case 2:
+		inPath, outPath = flag.Arg(0), flag.Arg(1)
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
+	if flagPlain && flagInclude {
+		log.Fatalln("xxd: -p and -i are mutually exclusive")
+	}
+	if flagCols < 0 || flagGroup < 0 {
+		log.Fatalln("xxd: invalid number of columns or group size")
+	}
+
+	err := xxd(inPath, outPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// xxd writes a hex dump of the input file to the output file or, if the "-r"
+// flag is set, converts the hex dump of the input file back to binary.
+func xxd(inPath, outPath string) (err error) {
+	// Open input file.
+	var fr *os.File
+	if inPath == StdinFileName {
+		fr = os.Stdin
+	} else {
+		fr, err = os.Open(inPath)
+		if err != nil {
+			return err
+		}
+		defer fr.Close()
+	}
+
+	// Open output file.
+	var fw *os.File
+	if outPath == StdoutFileName {
+		fw = os.Stdout
+	} else if flagReverse {
+		// Don't truncate the output file, so that hex dumps may be used to
+		// patch binary files.
+		fw, err = os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE, 0666)
+		if err != nil {
+			return err
+		}
+		defer fw.Close()
+	} else {
+		fw, err = os.Create(outPath)
+		if err != nil {
+			return err
+		}
+		defer fw.Close()
+	}
+
+	if flagReverse {
+		return reverse(fw, fr)
+	}
+
+	addr := flagSeek
+	if flagSeek < 0 {
+		// Start x bytes before the end if "-s" flag is negative.
+		addr, err = fr.Seek(flagSeek, io.SeekEnd)
+		if err != nil {
+			return fmt.Errorf("xxd: cannot seek %d bytes from the end of the input; %v", -flagSeek, err)
+		}
+	} else if flagSeek > 0 {
+		// Skip x bytes if "-s" flag is used.
+		_, err = fr.Seek(flagSeek, io.SeekStart)
+		if err != nil {
+			// Discard bytes of unseekable input.
+			_, err = io.CopyN(io.Discard, fr, flagSeek)
+			if err != nil && err != io.EOF {
+				return err
+			}
+		}
+	}
+	var r io.Reader = fr
+	if flagLength != 0 {
+		// Interpret only x bytes if "-l" flag is used.
+		r = io.LimitReader(fr, flagLength)
+	}
+
+	bw := bufio.NewWriter(fw)
+	switch {
+	case flagPlain:
+		err = dumpPlain(bw, r)
+	case flagInclude:
+		name := ""
+		if inPath != StdinFileName {
+			name = varName(inPath)
+		}
+		err = dumpInclude(bw, r, name)
+	default:
+		err = dump(bw, r, addr)
+	}
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// hexDigits returns the hex digits used for output.
+func hexDigits() string {
+	if flagUpper {
+		return "0123456789ABCDEF"
+	}
+	return "0123456789abcdef"
+}
+
+// dump writes a hex dump of r to w in the normal output mode, where addr is the
+// offset of the first byte.
+func dump(w *bufio.Writer, r io.Reader, addr int64) (err error) {
+	cols := flagCols
+	if cols == 0 {
+		cols = 16
+	}
+	digits := hexDigits()
+	buf := make([]byte, cols)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n == 0 {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		fmt.Fprintf(w, "%08x: ", addr)
+		for i := 0; i < cols; i++ {
+			if i < n {
+				w.WriteByte(digits[buf[i]>>4])
+				w.WriteByte(digits[buf[i]&0x0F])
+			} else {
+				w.WriteString("  ")
+			}
+			if (flagGroup != 0 && (i+1)%flagGroup == 0) || i == cols-1 {
+				w.WriteByte(' ')
+			}
+		}
+		w.WriteByte(' ')
+		for _, c := range buf[:n] {
+			if c < ' ' || c > '~' {
+				c = '.'
+			}
+			w.WriteByte(c)
+		}
+		w.WriteByte('\n')
+		addr += int64(n)
+		if err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// dumpPlain writes a plain hex dump of r to w, without offsets or ASCII.
+func dumpPlain(w *bufio.Writer, r io.Reader) (err error) {
+	cols := flagCols
+	if cols == 0 {
+		cols = 30
+	}
+	digits := hexDigits()
+	buf := make([]byte, cols)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n == 0 {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		for _, c := range buf[:n] {
+			w.WriteByte(digits[c>>4])
+			w.WriteByte(digits[c&0x0F])
+		}
+		w.WriteByte('\n')
+		if err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// dumpInclude writes the contents of r to w as a C include file. If name is
+// non-empty, the bytes are declared as an array of the given name, followed by
+// a declaration of its length.
+func dumpInclude(w *bufio.Writer, r io.Reader, name string) (err error) {
+	cols := flagCols
+	if cols == 0 {
+		cols = 12
+	}
+	digits := hexDigits()
+	prefix := "0x"
+	if flagUpper {
+		prefix = "0X"
+	}
+	if name != "" {
+		fmt.Fprintf(w, "unsigned char %s[] = {\n", name)
+	}
+	br := bufio.NewReader(r)
+	var n int64
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			if err != io.EOF {
+				return err
+			}
+			break
+		}
+		switch {
+		case n == 0:
+			w.WriteString("  ")
+		case n%int64(cols) == 0:
+			w.WriteString(",\n  ")
+		default:
+			w.WriteString(", ")
+		}
+		w.WriteString(prefix)
+		w.WriteByte(digits[c>>4])
+		w.WriteByte(digits[c&0x0F])
+		n++
+	}
+	if n > 0 {
+		w.WriteByte('\n')
+	}
+	if name != "" {
+		fmt.Fprintln(w, "};")
+		fmt.Fprintf(w, "unsigned int %s_len = %d;\n", name, n)
+	}
+	return nil
+}
+
+// varName returns a C variable name based on the provided file path, where all
+// characters which are not valid in C identifiers are replaced by underscores.
+func varName(filePath string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+			return r
+		}
+		return '_'
+	}, filepath.ToSlash(filePath))
+	if name != "" && '0' <= name[0] && name[0] <= '9' {
+		name = "__" + name
+	}
+	return name
+}
@@ -0,0 +1,124 @@
+package main
+
+import "bytes"
+import "fmt"
+import "os"
+import "path/filepath"
+import "testing"
+
+// xxdFlags holds the values of the flags of xxd.
+type xxdFlags struct {
+	cols, group int
+	plain       bool
+	reverse     bool
+	seek        int64
+}
+
+// set sets the flags of xxd, and returns a function which restores their
+// previous values.
+func (f xxdFlags) set() (restore func()) {
+	prev := xxdFlags{cols: flagCols, group: flagGroup, plain: flagPlain, reverse: flagReverse, seek: flagSeek}
+	flagCols, flagGroup, flagPlain, flagReverse, flagSeek = f.cols, f.group, f.plain, f.reverse, f.seek
+	return func() {
+		flagCols, flagGroup, flagPlain, flagReverse, flagSeek = prev.cols, prev.group, prev.plain, prev.reverse, prev.seek
+	}
+}
+
+// runXxd runs xxd with the provided flags on the file inPath, writing to the
+// file outPath.
+func runXxd(t *testing.T, flags xxdFlags, inPath, outPath string) {
+	t.Helper()
+	defer flags.set()()
+	err := xxd(inPath, outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	// Text and all byte values, which leave a partial last line at all tested
+	// line lengths.
+	input := []byte("Hello, world!\n")
+	for i := 0; i < 256; i++ {
+		input = append(input, byte(i))
+	}
+
+	golden := []struct {
+		name      string
+		dump, rev xxdFlags
+		want      []byte
+	}{
+		{name: "default", dump: xxdFlags{group: 2}, want: input},
+		{name: "-g 0", dump: xxdFlags{}, want: input},
+		{name: "-g 1", dump: xxdFlags{group: 1}, want: input},
+		{name: "-c 5", dump: xxdFlags{cols: 5, group: 2}, want: input},
+		{name: "-c 5 -g 1", dump: xxdFlags{cols: 5, group: 1}, want: input},
+		{name: "-p", dump: xxdFlags{plain: true}, rev: xxdFlags{plain: true}, want: input},
+		{name: "-p -c 5", dump: xxdFlags{cols: 5, plain: true}, rev: xxdFlags{plain: true}, want: input},
+		// The offsets of dumps of -s are those of the input, and -s with -r
+		// shifts them.
+		{name: "-s 3, -r -s -3", dump: xxdFlags{group: 2, seek: 3}, rev: xxdFlags{seek: -3}, want: input[3:]},
+		{name: "-r -s 4", dump: xxdFlags{group: 2}, rev: xxdFlags{seek: 4}, want: append(make([]byte, 4), input...)},
+		{name: "-p, -r -p -s 4", dump: xxdFlags{plain: true}, rev: xxdFlags{plain: true, seek: 4}, want: append(make([]byte, 4), input...)},
+	}
+	dir := t.TempDir()
+	inPath := filepath.Join(dir, "in")
+	err := os.WriteFile(inPath, input, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, g := range golden {
+		dumpPath := filepath.Join(dir, fmt.Sprintf("dump%d", i))
+		outPath := filepath.Join(dir, fmt.Sprintf("out%d", i))
+		runXxd(t, g.dump, inPath, dumpPath)
+		g.rev.reverse = true
+		runXxd(t, g.rev, dumpPath, outPath)
+		got, err := os.ReadFile(outPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, g.want) {
+			t.Errorf("%s: expected %q, got %q", g.name, g.want, got)
+		}
+	}
+}
+
+func TestReversePatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file")
+	err := os.WriteFile(path, []byte("hello world\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hex dumps overwrite the bytes at their offsets, and leave the rest of
+	// the file intact.
+	golden := []struct {
+		name  string
+		dump  string
+		flags xxdFlags
+		want  string
+	}{
+		{name: "offset", dump: "00000006: 574f  WO\n", want: "hello WOrld\n"},
+		{name: "grouped bytes", dump: "00000000: 48 45  HE\n", want: "HEllo WOrld\n"},
+		{name: "-s", dump: "00000000: 21  !\n", flags: xxdFlags{seek: 5}, want: "HEllo!WOrld\n"},
+		{name: "-p -s", dump: "4c4c\n", flags: xxdFlags{plain: true, seek: 2}, want: "HELLo!WOrld\n"},
+		{name: "append", dump: "0000000c: 2e0a  ..\n", want: "HELLo!WOrld\n.\n"},
+	}
+	for i, g := range golden {
+		dumpPath := filepath.Join(dir, fmt.Sprintf("dump%d", i))
+		err := os.WriteFile(dumpPath, []byte(g.dump), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g.flags.reverse = true
+		runXxd(t, g.flags, dumpPath, path)
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != g.want {
+			t.Errorf("%s: expected %q, got %q", g.name, g.want, got)
+		}
+	}
+}